@@ -0,0 +1,107 @@
+package gongrok
+
+/*
+	Copyright 2021 revzim.
+
+	Permission is hereby granted, free of charge, to any person obtaining a
+	copy of this software and associated documentation files (the "Software"),
+	to deal in the Software without restriction, including without limitation
+	the rights to use, copy, modify, merge, publish, distribute, sublicense,
+	and/or sell copies of the Software, and to permit persons to whom the Software
+	is furnished to do so, subject to the following conditions:
+
+	The above copyright notice and this permission notice shall be included
+	in all copies or substantial portions of the Software.
+
+	THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND,
+	EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES
+	OF MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT.
+	IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM,
+	DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE,
+	ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER
+	DEALINGS IN THE SOFTWARE.
+
+*/
+import (
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+
+	"gopkg.in/yaml.v2"
+)
+
+type (
+	// agentConfig -
+	// PER CLIENT NGROK CONFIG, LAYERED OVER Options.CFGPath
+	agentConfig struct {
+		AuthToken string `yaml:"authtoken,omitempty"` // ACCOUNT FOR THIS AGENT ONLY
+		WebAddr   string `yaml:"web_addr,omitempty"`  // AGENT API/WEB UI ADDR, ALLOCATED BY freeLoopbackAddr
+	}
+)
+
+// writeConfig -
+// WRITE PER CLIENT CONFIG TO A PRIVATE TEMP DIR & RETURN ITS PATH
+// EVERY AGENT GETS ITS OWN FREE web_addr SO CLIENTS NEVER RACE FOR 4040
+func (c *Client) writeConfig() (string, error) {
+	webAddr, err := freeLoopbackAddr()
+	if err != nil {
+		return "", err
+	}
+	cfg := agentConfig{AuthToken: c.Options.AuthToken, WebAddr: webAddr}
+	data, err := yaml.Marshal(cfg)
+	if err != nil {
+		return "", err
+	}
+	dir, err := ioutil.TempDir("", "gongrok-")
+	if err != nil {
+		return "", err
+	}
+	path := filepath.Join(dir, "ngrok.yml")
+	if err := ioutil.WriteFile(path, data, 0600); err != nil {
+		os.RemoveAll(dir)
+		return "", err
+	}
+	c.cfgMu.Lock()
+	c.cfgDir = dir
+	c.cfgMu.Unlock()
+	return path, nil
+}
+
+// freeLoopbackAddr -
+// 127.0.0.1:<PORT> FOR A PORT THE OS REPORTS FREE
+func freeLoopbackAddr() (string, error) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return "", err
+	}
+	defer l.Close()
+	return l.Addr().String(), nil
+}
+
+// defaultConfigPath -
+// NGROK'S OWN CONFIG, EMPTY IF MISSING
+// PASSING ANY --config SKIPS IT, SO IT IS LISTED EXPLICITLY BEFORE THE CLIENT CONFIG
+func defaultConfigPath() string {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	path := filepath.Join(home, ".ngrok2", "ngrok.yml")
+	if _, err := os.Stat(path); err != nil {
+		return ""
+	}
+	return path
+}
+
+// removeConfig -
+// DELETE PER CLIENT CONFIG, SAFE TO CALL MORE THAN ONCE
+func (c *Client) removeConfig() {
+	c.cfgMu.Lock()
+	defer c.cfgMu.Unlock()
+	if c.cfgDir == "" {
+		return
+	}
+	os.RemoveAll(c.cfgDir)
+	c.cfgDir = ""
+}
@@ -0,0 +1,64 @@
+package gongrok
+
+/*
+	Copyright 2021 revzim.
+
+	Permission is hereby granted, free of charge, to any person obtaining a
+	copy of this software and associated documentation files (the "Software"),
+	to deal in the Software without restriction, including without limitation
+	the rights to use, copy, modify, merge, publish, distribute, sublicense,
+	and/or sell copies of the Software, and to permit persons to whom the Software
+	is furnished to do so, subject to the following conditions:
+
+	The above copyright notice and this permission notice shall be included
+	in all copies or substantial portions of the Software.
+
+	THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND,
+	EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES
+	OF MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT.
+	IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM,
+	DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE,
+	ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER
+	DEALINGS IN THE SOFTWARE.
+
+*/
+import (
+	"context"
+	"strings"
+
+	"github.com/google/uuid"
+)
+
+// Attach -
+// RETURNS CLIENT BOUND TO AN ALREADY RUNNING NGROK AGENT AT ADDR (HOST:PORT)
+// EXISTING AGENT TUNNELS ARE LOADED INTO Client.Tunnels
+// Close ON AN ATTACHED CLIENT DETACHES WITHOUT KILLING THE AGENT
+func Attach(ctx context.Context, addr string, opts ...Options) (*Client, error) {
+	if Settings.ShouldLog {
+		Logger.Printf("Attaching to agent %s\n", addr)
+	}
+	opt := Options{}
+	if len(opts) > 0 {
+		opt = opts[0]
+	}
+	addr = strings.TrimSuffix(strings.TrimPrefix(strings.TrimPrefix(addr, "http://"), "https://"), "/")
+
+	c := &Client{
+		ID:             uuid.New().String(),
+		Options:        &opt,
+		NGROKLocalAddr: addr,
+		LogAPI:         Settings.LogAPI,
+		attached:       true,
+	}
+
+	// CONFIRMS AGENT API IS REACHABLE
+	tunnels, err := c.listTunnels(ctx)
+	if err != nil {
+		if Settings.ShouldLog {
+			Logger.Printf("attach agent %s err: %s\n", addr, err)
+		}
+		return nil, err
+	}
+	c.Tunnels = tunnels
+	return c, nil
+}
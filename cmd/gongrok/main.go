@@ -0,0 +1,346 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"syscall"
+	"text/tabwriter"
+	"time"
+
+	"github.com/revzim/gongrok"
+)
+
+const usage = `usage: gongrok [-f manifest] [-v] <command> [args]
+
+commands:
+  up      start the agent & create manifest tunnels, runs until the agent exits
+  down    close tunnels & stop the agent started by up
+  ls      list tunnels: name, proto, local, public, status
+  status  show agent & tunnel status
+  url     print the public url of tunnel <name>
+`
+
+func main() {
+	manifestPath := flag.String("f", "gongrok.yaml", "manifest file (.yaml, .yml or .json)")
+	verbose := flag.Bool("v", false, "log gongrok & ngrok output to stderr")
+	flag.Usage = func() {
+		fmt.Fprint(os.Stderr, usage)
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() < 1 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	if *verbose {
+		gongrok.Settings.ShouldLog = true
+		gongrok.Settings.LogAPI = true
+		gongrok.Logger = log.New(os.Stderr, "gongrok | > ", 0)
+	}
+
+	m, err := loadManifest(*manifestPath)
+	if err != nil {
+		fatal(err)
+	}
+
+	switch flag.Arg(0) {
+	case "up":
+		err = up(m)
+	case "down":
+		err = down(m)
+	case "ls":
+		err = ls(m)
+	case "status":
+		err = status(m)
+	case "url":
+		if flag.NArg() != 2 {
+			flag.Usage()
+			os.Exit(2)
+		}
+		err = url(m, flag.Arg(1))
+	default:
+		flag.Usage()
+		os.Exit(2)
+	}
+	if err != nil {
+		fatal(err)
+	}
+}
+
+// up -
+// START AGENT, CREATE TUNNELS & BLOCK UNTIL AGENT EXITS OR A SIGNAL ARRIVES
+func up(m *manifest) error {
+	if rt, err := loadRuntime(m.Runtime); err == nil && processAlive(rt.PID) {
+		return fmt.Errorf("already up (pid %d), run down first", rt.PID)
+	}
+
+	// up SHUTS THE AGENT DOWN ITSELF SO DEFERRED CLEANUP RUNS
+	gongrok.Settings.HandleSignals = false
+	signalChan := make(chan os.Signal, 1)
+	signal.Notify(signalChan, syscall.SIGHUP, syscall.SIGINT, syscall.SIGTERM, syscall.SIGQUIT)
+	defer signal.Stop(signalChan)
+
+	// RUNS LAST, AFTER EXPORTS & WEBHOOKS STOP
+	defer removeFiles(m)
+
+	if m.Options.NGROKPath != "" {
+		gongrok.Settings.Path = m.Options.NGROKPath
+	}
+	for _, hook := range m.Webhooks {
+		defer gongrok.AddWebhook(hook)()
+	}
+	defer gongrok.ExportURLs(m.Export)()
+	client, err := gongrok.NewClient(m.Options)
+	if err != nil {
+		return err
+	}
+	if err := client.Start(); err != nil {
+		return err
+	}
+
+	for _, t := range m.Tunnels {
+		if err := client.AddTunnel(t); err != nil {
+			client.Close()
+			return err
+		}
+	}
+	if len(client.Tunnels) > 0 {
+		if err := client.ConnectAll(); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+		}
+	}
+
+	rt := &runtime{PID: os.Getpid(), WebAddr: client.NGROKLocalAddr}
+	for _, t := range client.Snapshot() {
+		rt.Tunnels = append(rt.Tunnels, t.Name)
+	}
+	if err := writeRuntime(m.Runtime, rt); err != nil {
+		client.Close()
+		return err
+	}
+	printTunnels(m.Tunnels, client.Snapshot())
+
+	select {
+	case <-client.Done():
+		return fmt.Errorf("ngrok agent exited")
+	case s := <-signalChan:
+		fmt.Fprintf(os.Stderr, "%s, shutting down\n", s)
+	}
+	if len(client.Tunnels) > 0 {
+		if err := client.DisconnectAll(); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+		}
+	}
+	if err := client.Close(); err != nil {
+		return err
+	}
+	<-client.Done()
+	return nil
+}
+
+// removeFiles -
+// DELETE RUNTIME & EXPORTED URL FILES WRITTEN WHILE up
+func removeFiles(m *manifest) {
+	os.Remove(m.Runtime)
+	os.Remove(m.Export.JSONFile)
+	if m.Export.EnvFile != "" {
+		os.Remove(m.Export.EnvFile)
+	}
+}
+
+// down -
+// CLOSE TUNNELS CREATED BY up VIA AGENT API & STOP up PROCESS
+func down(m *manifest) error {
+	rt, err := loadRuntime(m.Runtime)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return fmt.Errorf("not up")
+		}
+		return err
+	}
+	defer removeFiles(m)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if client, err := gongrok.Attach(ctx, rt.WebAddr); err == nil {
+		for _, name := range rt.Tunnels {
+			if client.FindTunnel(name) == nil {
+				continue
+			}
+			if err := client.DisconnectTunnel(name); err != nil {
+				fmt.Fprintln(os.Stderr, err)
+			}
+		}
+	}
+
+	if processAlive(rt.PID) {
+		p, err := os.FindProcess(rt.PID)
+		if err != nil {
+			return err
+		}
+		if err := p.Signal(syscall.SIGTERM); err != nil {
+			return err
+		}
+	}
+	fmt.Println("down")
+	return nil
+}
+
+// ls -
+// TABLE OF MANIFEST & LIVE TUNNELS
+func ls(m *manifest) error {
+	printTunnels(m.Tunnels, liveTunnels(m))
+	return nil
+}
+
+// status -
+// AGENT SUMMARY & TUNNEL COUNTS
+func status(m *manifest) error {
+	rt, err := loadRuntime(m.Runtime)
+	if err != nil {
+		if os.IsNotExist(err) {
+			fmt.Println("agent: down")
+			return nil
+		}
+		return err
+	}
+
+	state := "down"
+	if processAlive(rt.PID) {
+		state = "up"
+	}
+	live := liveTunnels(m)
+	online := 0
+	for _, t := range m.Tunnels {
+		if findTunnel(live, t.Name) != nil {
+			online++
+		}
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintf(w, "agent:\t%s\n", state)
+	fmt.Fprintf(w, "pid:\t%d\n", rt.PID)
+	region := m.Options.Region
+	if region == "" {
+		region = "us"
+	}
+	fmt.Fprintf(w, "web addr:\t%s\n", rt.WebAddr)
+	fmt.Fprintf(w, "region:\t%s\n", region)
+	fmt.Fprintf(w, "tunnels:\t%d/%d online\n", online, len(m.Tunnels))
+	return w.Flush()
+}
+
+// url -
+// PUBLIC URL OF TUNNEL NAME FROM THE EXPORTED URL FILE, FALLS BACK TO THE AGENT
+// FAILS IF THE up PROCESS OR ITS AGENT IS GONE, SO STALE FILES ARE NEVER TRUSTED
+func url(m *manifest, name string) error {
+	rt, err := loadRuntime(m.Runtime)
+	if err != nil || !processAlive(rt.PID) {
+		return fmt.Errorf("not up")
+	}
+	live := liveTunnels(m)
+	if live == nil {
+		return fmt.Errorf("agent at %s unreachable", rt.WebAddr)
+	}
+	if urls, err := gongrok.ReadURLs(m.Export.JSONFile); err == nil {
+		if u, ok := urls[name]; ok {
+			fmt.Println(u)
+			return nil
+		}
+	}
+	if t := findTunnel(live, name); t != nil && t.RemoteAddress != "" {
+		fmt.Println(t.RemoteAddress)
+		return nil
+	}
+	return fmt.Errorf("no public url for tunnel %s", name)
+}
+
+// liveTunnels -
+// TUNNELS ON THE AGENT STARTED BY up, NIL IF UNREACHABLE
+func liveTunnels(m *manifest) []*gongrok.Tunnel {
+	rt, err := loadRuntime(m.Runtime)
+	if err != nil {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	client, err := gongrok.Attach(ctx, rt.WebAddr)
+	if err != nil {
+		return nil
+	}
+	return client.Tunnels
+}
+
+// printTunnels -
+// NAME | PROTO | LOCAL | PUBLIC | STATUS FOR DESIRED TUNNELS, THEN UNMANAGED LIVE ONES
+func printTunnels(desired, live []*gongrok.Tunnel) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "NAME\tPROTO\tLOCAL\tPUBLIC\tSTATUS")
+	for _, t := range desired {
+		public, status := "-", "offline"
+		if l := findTunnel(live, t.Name); l != nil {
+			public, status = l.RemoteAddress, "online"
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", t.Name, t.Proto, t.LocalAddress, public, status)
+	}
+	for _, l := range live {
+		if findTunnel(desired, l.Name) == nil {
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", l.Name, l.Proto, l.LocalAddress, l.RemoteAddress, "unmanaged")
+		}
+	}
+	w.Flush()
+}
+
+// findTunnel -
+// TUNNEL W/ NAME OR NIL
+func findTunnel(tunnels []*gongrok.Tunnel, name string) *gongrok.Tunnel {
+	for _, t := range tunnels {
+		if t.Name == name {
+			return t
+		}
+	}
+	return nil
+}
+
+// writeRuntime -
+// WRITE RUNTIME FILE W/ 0600, CREATING ITS DIR
+func writeRuntime(path string, rt *runtime) error {
+	data, err := json.MarshalIndent(rt, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+	if err := ioutil.WriteFile(path, data, 0600); err != nil {
+		return err
+	}
+	// WriteFile KEEPS THE MODE OF A FILE LEFT BY AN EARLIER up
+	return os.Chmod(path, 0600)
+}
+
+// processAlive -
+// IF PID IS A RUNNING PROCESS
+func processAlive(pid int) bool {
+	if pid <= 0 {
+		return false
+	}
+	p, err := os.FindProcess(pid)
+	if err != nil {
+		return false
+	}
+	return p.Signal(syscall.Signal(0)) == nil
+}
+
+func fatal(err error) {
+	fmt.Fprintln(os.Stderr, "gongrok:", err)
+	os.Exit(1)
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+
+	"github.com/revzim/gongrok"
+)
+
+type (
+	// manifest -
+	// OPTIONS & TUNNELS TO RUN, YAML OR JSON
+	// FIELDS USE THE gongrok JSON WIRE FORMAT
+	manifest struct {
+		Options  gongrok.Options   `json:"options"`  // AGENT OPTIONS
+		Tunnels  []*gongrok.Tunnel `json:"tunnels"`  // TUNNELS TO CREATE ON up
+		Webhooks []gongrok.Webhook `json:"webhooks"` // NOTIFIED OF TUNNEL CHANGES WHILE up
+		Export   gongrok.URLExport `json:"export"`   // PUBLIC URL FILES, DEFAULT JSON .gongrok/urls.json
+		Runtime  string            `json:"runtime"`  // RUNNING AGENT FILE, DEFAULT .gongrok/runtime.json
+	}
+
+	// runtime -
+	// WRITTEN BY up SO OTHER SUBCOMMANDS CAN FIND THE AGENT, NO SECRETS
+	runtime struct {
+		PID     int      `json:"pid"`     // up PROCESS
+		WebAddr string   `json:"webaddr"` // AGENT API ADDR
+		Tunnels []string `json:"tunnels"` // TUNNELS CREATED BY up
+	}
+)
+
+// loadManifest -
+// READ MANIFEST AT PATH, .yaml/.yml ARE CONVERTED TO JSON FIRST
+func loadManifest(path string) (*manifest, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	ext := strings.ToLower(filepath.Ext(path))
+	if ext == ".yaml" || ext == ".yml" {
+		data, err = yamlToJSON(data)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %s", path, err)
+		}
+	}
+	m := &manifest{}
+	if err := json.Unmarshal(data, m); err != nil {
+		return nil, fmt.Errorf("%s: %s", path, err)
+	}
+	if m.Runtime == "" {
+		m.Runtime = filepath.Join(".gongrok", "runtime.json")
+	}
+	if m.Export.JSONFile == "" {
+		m.Export.JSONFile = filepath.Join(".gongrok", "urls.json")
+	}
+	return m, nil
+}
+
+// yamlToJSON -
+// CONVERT YAML DOCUMENT TO JSON SO WIRE FORMAT TAGS APPLY
+func yamlToJSON(data []byte) ([]byte, error) {
+	var doc interface{}
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, err
+	}
+	return json.Marshal(stringKeys(doc))
+}
+
+// stringKeys -
+// yaml.v2 DECODES MAPS W/ interface{} KEYS, JSON NEEDS STRINGS
+func stringKeys(v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[interface{}]interface{}:
+		m := make(map[string]interface{}, len(v))
+		for k, val := range v {
+			m[fmt.Sprint(k)] = stringKeys(val)
+		}
+		return m
+	case []interface{}:
+		for i := range v {
+			v[i] = stringKeys(v[i])
+		}
+		return v
+	}
+	return v
+}
+
+// loadRuntime -
+// READ RUNTIME FILE WRITTEN BY up
+func loadRuntime(path string) (*runtime, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	rt := &runtime{}
+	if err := json.Unmarshal(data, rt); err != nil {
+		return nil, fmt.Errorf("%s: %s", path, err)
+	}
+	return rt, nil
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"syscall"
+
+	"github.com/revzim/gongrok"
+	"github.com/revzim/gongrok/daemon"
+)
+
+func main() {
+	socket := flag.String("socket", filepath.Join(os.TempDir(), "gongrokd.sock"), "control socket path")
+	binPath := flag.String("bin", gongrok.Settings.Path, "ngrok binary path")
+	region := flag.String("region", "us", "tunnel region")
+	authToken := flag.String("authtoken", "", "ngrok authtoken")
+	maxAgents := flag.Int("agents", 1, "max ngrok agents to run")
+	perAgent := flag.Int("per-agent", 4, "max tunnels per agent")
+	verbose := flag.Bool("v", false, "log gongrok & ngrok output to stderr")
+	flag.Parse()
+
+	if *verbose {
+		gongrok.Settings.ShouldLog = true
+		gongrok.Settings.LogAPI = true
+		gongrok.Logger = log.New(os.Stderr, "gongrokd | > ", 0)
+	}
+	// DAEMON SHUTS AGENTS DOWN ITSELF
+	gongrok.Settings.HandleSignals = false
+	gongrok.Settings.Path = *binPath
+
+	pool := gongrok.NewPool(gongrok.Options{
+		NGROKPath: *binPath,
+		Region:    *region,
+		AuthToken: *authToken,
+	}, *maxAgents, *perAgent)
+	srv := daemon.NewServer(pool)
+
+	shutdown := make(chan struct{})
+	signalChan := make(chan os.Signal, 1)
+	signal.Notify(signalChan, syscall.SIGHUP, syscall.SIGINT, syscall.SIGTERM, syscall.SIGQUIT)
+	go func() {
+		<-signalChan
+		if err := srv.Close(); err != nil {
+			fmt.Fprintln(os.Stderr, "gongrokd: close:", err)
+		}
+		os.Remove(*socket)
+		close(shutdown)
+	}()
+
+	fmt.Fprintf(os.Stderr, "gongrokd listening on %s\n", *socket)
+	if err := srv.ListenAndServe(*socket); err != nil {
+		fmt.Fprintln(os.Stderr, "gongrokd:", err)
+		os.Exit(1)
+	}
+	<-shutdown
+}
@@ -0,0 +1,112 @@
+package daemon
+
+/*
+	Copyright 2021 revzim.
+
+	Permission is hereby granted, free of charge, to any person obtaining a
+	copy of this software and associated documentation files (the "Software"),
+	to deal in the Software without restriction, including without limitation
+	the rights to use, copy, modify, merge, publish, distribute, sublicense,
+	and/or sell copies of the Software, and to permit persons to whom the Software
+	is furnished to do so, subject to the following conditions:
+
+	The above copyright notice and this permission notice shall be included
+	in all copies or substantial portions of the Software.
+
+	THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND,
+	EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES
+	OF MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT.
+	IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM,
+	DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE,
+	ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER
+	DEALINGS IN THE SOFTWARE.
+
+*/
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"net"
+	"sync"
+
+	"github.com/revzim/gongrok"
+)
+
+type (
+	// Conn -
+	// CONTROL CONNECTION TO A RUNNING DAEMON
+	// TUNNELS OPENED THROUGH CONN CLOSE WHEN IT DOES
+	Conn struct {
+		conn    net.Conn
+		scanner *bufio.Scanner
+		enc     *json.Encoder
+		mu      sync.Mutex
+	}
+)
+
+// Dial -
+// CONNECT TO DAEMON LISTENING ON UNIX SOCKET PATH
+func Dial(path string) (*Conn, error) {
+	conn, err := net.Dial("unix", path)
+	if err != nil {
+		return nil, err
+	}
+	return &Conn{conn: conn, scanner: bufio.NewScanner(conn), enc: json.NewEncoder(conn)}, nil
+}
+
+// Open -
+// ASK DAEMON TO OPEN TUNNEL, RETURNS IT W/ RemoteAddress SET
+func (c *Conn) Open(t *gongrok.Tunnel) (*gongrok.Tunnel, error) {
+	res, err := c.do(&Request{Op: OpOpen, Tunnel: t})
+	if err != nil {
+		return nil, err
+	}
+	return res.Tunnel, nil
+}
+
+// CloseTunnel -
+// ASK DAEMON TO CLOSE TUNNEL NAME OPENED BY THIS CONN
+func (c *Conn) CloseTunnel(name string) error {
+	_, err := c.do(&Request{Op: OpClose, Name: name})
+	return err
+}
+
+// List -
+// EVERY TUNNEL THE DAEMON IS RUNNING
+func (c *Conn) List() ([]*gongrok.Tunnel, error) {
+	res, err := c.do(&Request{Op: OpList})
+	if err != nil {
+		return nil, err
+	}
+	return res.Tunnels, nil
+}
+
+// Close -
+// DISCONNECT, DAEMON CLOSES TUNNELS OPENED BY THIS CONN
+func (c *Conn) Close() error {
+	return c.conn.Close()
+}
+
+// do -
+// SEND REQUEST & READ ITS RESPONSE
+func (c *Conn) do(req *Request) (*Response, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err := c.enc.Encode(req); err != nil {
+		return nil, err
+	}
+	if !c.scanner.Scan() {
+		if err := c.scanner.Err(); err != nil {
+			return nil, err
+		}
+		return nil, errors.New("daemon closed connection")
+	}
+	res := &Response{}
+	if err := json.Unmarshal(c.scanner.Bytes(), res); err != nil {
+		return nil, err
+	}
+	if !res.OK {
+		return nil, errors.New(res.Error)
+	}
+	return res, nil
+}
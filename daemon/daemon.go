@@ -0,0 +1,235 @@
+package daemon
+
+/*
+	Copyright 2021 revzim.
+
+	Permission is hereby granted, free of charge, to any person obtaining a
+	copy of this software and associated documentation files (the "Software"),
+	to deal in the Software without restriction, including without limitation
+	the rights to use, copy, modify, merge, publish, distribute, sublicense,
+	and/or sell copies of the Software, and to permit persons to whom the Software
+	is furnished to do so, subject to the following conditions:
+
+	The above copyright notice and this permission notice shall be included
+	in all copies or substantial portions of the Software.
+
+	THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND,
+	EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES
+	OF MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT.
+	IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM,
+	DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE,
+	ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER
+	DEALINGS IN THE SOFTWARE.
+
+*/
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"sort"
+	"sync"
+
+	"github.com/revzim/gongrok"
+)
+
+type (
+	// Request -
+	// ONE LINE OF JSON SENT OVER THE CONTROL SOCKET
+	Request struct {
+		Op     string          `json:"op"`               // OpOpen | OpClose | OpList
+		Tunnel *gongrok.Tunnel `json:"tunnel,omitempty"` // TUNNEL TO OPEN
+		Name   string          `json:"name,omitempty"`   // TUNNEL TO CLOSE
+	}
+
+	// Response -
+	// ONE LINE OF JSON SENT BACK FOR EACH REQUEST
+	Response struct {
+		OK      bool              `json:"ok"`                // REQUEST SUCCEEDED
+		Error   string            `json:"error,omitempty"`   // WHY REQUEST FAILED
+		Tunnel  *gongrok.Tunnel   `json:"tunnel,omitempty"`  // OPENED TUNNEL
+		Tunnels []*gongrok.Tunnel `json:"tunnels,omitempty"` // ALL TUNNELS FOR OpList
+	}
+
+	// Server -
+	// OWNS A gongrok.Pool & SERVES THE CONTROL SOCKET
+	// TUNNELS ARE CLOSED WHEN THE CONNECTION THAT OPENED THEM DISCONNECTS
+	Server struct {
+		Pool   *gongrok.Pool
+		owners map[string]net.Conn // TUNNEL NAME -> OWNING CONNECTION
+		ln     net.Listener
+		closed bool
+		mu     sync.Mutex
+	}
+)
+
+// CONTROL OPS
+const (
+	OpOpen  = "open"
+	OpClose = "close"
+	OpList  = "list"
+)
+
+// NewServer -
+// INITS & RETURNS NEW SERVER FOR POOL
+func NewServer(pool *gongrok.Pool) *Server {
+	return &Server{Pool: pool, owners: make(map[string]net.Conn)}
+}
+
+// ListenAndServe -
+// LISTEN ON UNIX SOCKET PATH & SERVE UNTIL Close
+// A STALE SOCKET FILE AT PATH IS REMOVED
+func (s *Server) ListenAndServe(path string) error {
+	if conn, err := net.Dial("unix", path); err == nil {
+		conn.Close()
+		return fmt.Errorf("daemon already listening on %s", path)
+	}
+	os.Remove(path)
+	ln, err := net.Listen("unix", path)
+	if err != nil {
+		return err
+	}
+	if err := os.Chmod(path, 0600); err != nil {
+		ln.Close()
+		return err
+	}
+	return s.Serve(ln)
+}
+
+// Serve -
+// ACCEPT CONTROL CONNECTIONS ON LN
+// RETURNS NIL ONCE Close IS CALLED
+func (s *Server) Serve(ln net.Listener) error {
+	s.mu.Lock()
+	s.ln = ln
+	s.mu.Unlock()
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			s.mu.Lock()
+			closed := s.closed
+			s.mu.Unlock()
+			if closed {
+				return nil
+			}
+			return err
+		}
+		go s.handle(conn)
+	}
+}
+
+// Close -
+// STOP LISTENING & CLOSE EVERY AGENT IN POOL
+func (s *Server) Close() error {
+	s.mu.Lock()
+	s.closed = true
+	if s.ln != nil {
+		s.ln.Close()
+	}
+	for _, conn := range s.owners {
+		conn.Close()
+	}
+	s.owners = make(map[string]net.Conn)
+	s.mu.Unlock()
+	return s.Pool.Close()
+}
+
+// handle -
+// SERVE REQUESTS ON CONN UNTIL IT DISCONNECTS, THEN CLOSE ITS TUNNELS
+func (s *Server) handle(conn net.Conn) {
+	defer s.release(conn)
+	defer conn.Close()
+
+	scanner := bufio.NewScanner(conn)
+	enc := json.NewEncoder(conn)
+	for scanner.Scan() {
+		req := &Request{}
+		res := &Response{}
+		if err := json.Unmarshal(scanner.Bytes(), req); err != nil {
+			res.Error = err.Error()
+		} else if err := s.do(conn, req, res); err != nil {
+			res.Error = err.Error()
+		} else {
+			res.OK = true
+		}
+		if err := enc.Encode(res); err != nil {
+			return
+		}
+	}
+}
+
+// do -
+// RUN A SINGLE REQUEST FOR CONN
+func (s *Server) do(conn net.Conn, req *Request, res *Response) error {
+	switch req.Op {
+	case OpOpen:
+		if req.Tunnel == nil {
+			return errors.New("open: missing tunnel")
+		}
+		if err := s.Pool.AddTunnel(req.Tunnel); err != nil {
+			return err
+		}
+		s.mu.Lock()
+		s.owners[req.Tunnel.Name] = conn
+		s.mu.Unlock()
+		if gongrok.Settings.ShouldLog {
+			gongrok.Logger.Printf("daemon: opened %s for %s\n", req.Tunnel.Name, conn.RemoteAddr())
+		}
+		res.Tunnel = req.Tunnel
+		if c, _ := s.Pool.Lookup(req.Tunnel.Name); c != nil {
+			if t := c.FindTunnel(req.Tunnel.Name); t != nil {
+				res.Tunnel = t
+			}
+		}
+		return nil
+	case OpClose:
+		s.mu.Lock()
+		owner, ok := s.owners[req.Name]
+		s.mu.Unlock()
+		if !ok {
+			return fmt.Errorf("close: no tunnel %s", req.Name)
+		}
+		if owner != conn {
+			return fmt.Errorf("close: tunnel %s is owned by another connection", req.Name)
+		}
+		if err := s.Pool.RemoveTunnel(req.Name); err != nil {
+			return err
+		}
+		s.mu.Lock()
+		delete(s.owners, req.Name)
+		s.mu.Unlock()
+		return nil
+	case OpList:
+		res.Tunnels = s.Pool.Tunnels()
+		sort.Slice(res.Tunnels, func(i, j int) bool {
+			return res.Tunnels[i].Name < res.Tunnels[j].Name
+		})
+		return nil
+	}
+	return fmt.Errorf("unknown op %q", req.Op)
+}
+
+// release -
+// CLOSE EVERY TUNNEL OWNED BY CONN
+func (s *Server) release(conn net.Conn) {
+	s.mu.Lock()
+	names := make([]string, 0)
+	for name, owner := range s.owners {
+		if owner == conn {
+			names = append(names, name)
+			delete(s.owners, name)
+		}
+	}
+	s.mu.Unlock()
+
+	for _, name := range names {
+		if gongrok.Settings.ShouldLog {
+			gongrok.Logger.Printf("daemon: owner disconnected, closing %s\n", name)
+		}
+		if err := s.Pool.RemoveTunnel(name); err != nil && gongrok.Settings.ShouldLog {
+			gongrok.Logger.Printf("daemon: close %s err: %s\n", name, err)
+		}
+	}
+}
@@ -0,0 +1,71 @@
+package gongrok
+
+/*
+	Copyright 2021 revzim.
+
+	Permission is hereby granted, free of charge, to any person obtaining a
+	copy of this software and associated documentation files (the "Software"),
+	to deal in the Software without restriction, including without limitation
+	the rights to use, copy, modify, merge, publish, distribute, sublicense,
+	and/or sell copies of the Software, and to permit persons to whom the Software
+	is furnished to do so, subject to the following conditions:
+
+	The above copyright notice and this permission notice shall be included
+	in all copies or substantial portions of the Software.
+
+	THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND,
+	EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES
+	OF MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT.
+	IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM,
+	DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE,
+	ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER
+	DEALINGS IN THE SOFTWARE.
+
+*/
+import (
+	"time"
+)
+
+// wait -
+// UNADVERTISE TUNNEL & POLL ITS OPEN CONNECTIONS UNTIL NONE REMAIN OR TIMEOUT PASSES
+// NEVER FAILS, THE CALLER CLOSES THE TUNNEL EITHER WAY
+func (d *Drain) wait(c *Client, t *Tunnel) {
+	timeout := time.Duration(d.Timeout)
+	if timeout <= 0 {
+		timeout = 30 * time.Second
+	}
+	interval := time.Duration(d.Interval)
+	if interval <= 0 {
+		interval = time.Second
+	}
+
+	if d.Unadvertise != nil {
+		if err := d.Unadvertise(t); err != nil && Settings.ShouldLog {
+			Logger.Printf("unadvertise tunnel %s err: %s\n", t.Name, err)
+		}
+	}
+	c.emit(EventTunnelDraining, t, "")
+
+	if Settings.ShouldLog {
+		Logger.Printf("Draining tunnel %s...\n", t.Name)
+	}
+	deadline := time.Now().Add(timeout)
+	for {
+		metrics, err := c.TunnelMetrics(t.Name)
+		switch {
+		case err == nil && metrics.Conns.Gauge < 1:
+			return
+		case IsNotFound(err):
+			return
+		case err != nil && Settings.ShouldLog:
+			Logger.Printf("drain tunnel %s metrics err: %s\n", t.Name, err)
+		}
+		if time.Now().Add(interval).After(deadline) {
+			if Settings.ShouldLog {
+				Logger.Printf("drain tunnel %s timed out after %s, closing\n", t.Name, timeout)
+			}
+			return
+		}
+		time.Sleep(interval)
+	}
+}
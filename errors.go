@@ -0,0 +1,193 @@
+package gongrok
+
+/*
+	Copyright 2021 revzim.
+
+	Permission is hereby granted, free of charge, to any person obtaining a
+	copy of this software and associated documentation files (the "Software"),
+	to deal in the Software without restriction, including without limitation
+	the rights to use, copy, modify, merge, publish, distribute, sublicense,
+	and/or sell copies of the Software, and to permit persons to whom the Software
+	is furnished to do so, subject to the following conditions:
+
+	The above copyright notice and this permission notice shall be included
+	in all copies or substantial portions of the Software.
+
+	THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND,
+	EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES
+	OF MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT.
+	IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM,
+	DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE,
+	ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER
+	DEALINGS IN THE SOFTWARE.
+
+*/
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+var (
+	// ErrSessionLimit -
+	// NGROK REFUSED TO START, ACCOUNT SESSION LIMIT REACHED
+	ErrSessionLimit = errors.New("ngrok session limit reached")
+
+	// ErrAddrInUse -
+	// NGROK REFUSED TO START, WEB ADDR ALREADY IN USE
+	ErrAddrInUse = errors.New("ngrok addr already in use")
+
+	// ErrTooManyAgents -
+	// Manager ALREADY RUNS Manager.MaxAgents AGENTS
+	ErrTooManyAgents = errors.New("too many agents")
+
+	// ErrUpstreamUnreachable -
+	// TUNNEL PREFLIGHT TIMED OUT WAITING FOR LocalAddress
+	ErrUpstreamUnreachable = errors.New("upstream unreachable")
+
+	// planLimitFragments -
+	// AGENT MESSAGES RETURNED WHEN THE ACCOUNT PLAN DOES NOT ALLOW A REQUEST
+	planLimitFragments = []string{
+		"is limited to",
+		"paid plan",
+		"upgrade your account",
+		"only available to",
+	}
+)
+
+// Error -
+// FORMATS API ERROR W/ STATUS, CODE & DETAILS
+func (e *APIError) Error() string {
+	msg := fmt.Sprintf("error api: %d", e.StatusCode)
+	if e.ErrorCode != 0 {
+		msg += fmt.Sprintf(" (code %d)", e.ErrorCode)
+	}
+	if e.Msg != "" {
+		msg += ": " + e.Msg
+	}
+	if detail := e.detail(); detail != "" {
+		msg += ": " + detail
+	}
+	return msg
+}
+
+// detail -
+// RETURNS details.err IF SET
+func (e *APIError) detail() string {
+	if e.Details == nil {
+		return ""
+	}
+	if err, ok := e.Details["err"].(string); ok {
+		return err
+	}
+	return ""
+}
+
+// newAPIError -
+// DECODE NON-2XX AGENT RESPONSE INTO *APIError
+// NON-JSON BODIES ARE KEPT AS THE MESSAGE
+func newAPIError(res *http.Response) error {
+	body, _ := ioutil.ReadAll(res.Body)
+	apiErr := &APIError{}
+	if err := json.Unmarshal(body, apiErr); err != nil || (apiErr.Msg == "" && apiErr.StatusCode == 0) {
+		apiErr = &APIError{Msg: strings.TrimSpace(string(body))}
+	}
+	if apiErr.StatusCode == 0 {
+		apiErr.StatusCode = res.StatusCode
+	}
+	return apiErr
+}
+
+// IsNotFound -
+// IF ERR IS AN AGENT API 404
+func IsNotFound(err error) bool {
+	var apiErr *APIError
+	return errors.As(err, &apiErr) && apiErr.StatusCode == http.StatusNotFound
+}
+
+// IsConflict -
+// IF ERR IS AN AGENT API CONFLICT, E.G. TUNNEL NAME ALREADY EXISTS
+func IsConflict(err error) bool {
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) {
+		return false
+	}
+	if apiErr.StatusCode == http.StatusConflict {
+		return true
+	}
+	return strings.Contains(strings.ToLower(apiErr.Msg+" "+apiErr.detail()), "already exists")
+}
+
+// IsPlanLimit -
+// IF ERR IS AN AGENT API ERROR CAUSED BY ACCOUNT PLAN LIMITS
+func IsPlanLimit(err error) bool {
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) {
+		return false
+	}
+	if apiErr.StatusCode == http.StatusPaymentRequired {
+		return true
+	}
+	msg := strings.ToLower(apiErr.Msg + " " + apiErr.detail())
+	for _, frag := range planLimitFragments {
+		if strings.Contains(msg, frag) {
+			return true
+		}
+	}
+	return false
+}
+
+// Error -
+// LISTS EVERY FAILED TUNNEL & ITS ERROR
+func (e *MultiError) Error() string {
+	failed := e.Failed()
+	msgs := make([]string, 0, len(failed))
+	for _, name := range failed {
+		msgs = append(msgs, fmt.Sprintf("%s: %s", name, e.Results[name]))
+	}
+	msg := fmt.Sprintf("%d of %d tunnels failed: %s", len(failed), len(e.Results), strings.Join(msgs, "; "))
+	if len(e.RolledBack) > 0 {
+		msg += fmt.Sprintf(" (rolled back: %s)", strings.Join(e.RolledBack, ", "))
+	}
+	if len(e.RollbackFailed) > 0 {
+		names := make([]string, 0, len(e.RollbackFailed))
+		for name := range e.RollbackFailed {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		msgs := make([]string, 0, len(names))
+		for _, name := range names {
+			msgs = append(msgs, fmt.Sprintf("%s: %s", name, e.RollbackFailed[name]))
+		}
+		msg += fmt.Sprintf(" (rollback failed: %s)", strings.Join(msgs, "; "))
+	}
+	return msg
+}
+
+// Failed -
+// RETURNS SORTED NAMES OF TUNNELS THAT FAILED
+func (e *MultiError) Failed() []string {
+	names := make([]string, 0)
+	for name, err := range e.Results {
+		if err != nil {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// failed -
+// IF ANY TUNNEL FAILED
+func (e *MultiError) failed() bool {
+	for _, err := range e.Results {
+		if err != nil {
+			return true
+		}
+	}
+	return false
+}
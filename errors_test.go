@@ -0,0 +1,100 @@
+package gongrok
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestNewAPIError(t *testing.T) {
+	for _, tc := range []struct {
+		name   string
+		status int
+		body   string
+		want   APIError
+	}{
+		{
+			"json",
+			http.StatusBadRequest,
+			`{"error_code": 102, "status_code": 400, "msg": "invalid tunnel configuration", "details": {"err": "yaml: unmarshal errors"}}`,
+			APIError{ErrorCode: 102, StatusCode: 400, Msg: "invalid tunnel configuration", Details: Map{"err": "yaml: unmarshal errors"}},
+		},
+		{
+			"json w/o status",
+			http.StatusNotFound,
+			`{"error_code": 100, "msg": "tunnel not found"}`,
+			APIError{ErrorCode: 100, StatusCode: 404, Msg: "tunnel not found"},
+		},
+		{
+			"plain text",
+			http.StatusBadGateway,
+			"upstream connect error\n",
+			APIError{StatusCode: 502, Msg: "upstream connect error"},
+		},
+		{
+			"html",
+			http.StatusInternalServerError,
+			"<html><body>oops</body></html>",
+			APIError{StatusCode: 500, Msg: "<html><body>oops</body></html>"},
+		},
+		{
+			"empty json",
+			http.StatusServiceUnavailable,
+			`{}`,
+			APIError{StatusCode: 503, Msg: "{}"},
+		},
+	} {
+		res := &http.Response{StatusCode: tc.status, Body: ioutil.NopCloser(strings.NewReader(tc.body))}
+		var apiErr *APIError
+		if !errors.As(newAPIError(res), &apiErr) {
+			t.Fatalf("%s: newAPIError is not *APIError", tc.name)
+		}
+		if apiErr.ErrorCode != tc.want.ErrorCode || apiErr.StatusCode != tc.want.StatusCode || apiErr.Msg != tc.want.Msg || apiErr.detail() != tc.want.detail() {
+			t.Errorf("%s: newAPIError = %+v, want %+v", tc.name, apiErr, tc.want)
+		}
+	}
+}
+
+func TestAPIErrorString(t *testing.T) {
+	err := &APIError{ErrorCode: 102, StatusCode: 400, Msg: "invalid tunnel configuration", Details: Map{"err": "bad addr"}}
+	if got, want := err.Error(), "error api: 400 (code 102): invalid tunnel configuration: bad addr"; got != want {
+		t.Errorf("Error() = %q, want %q", got, want)
+	}
+	if got, want := (&APIError{StatusCode: 502}).Error(), "error api: 502"; got != want {
+		t.Errorf("Error() = %q, want %q", got, want)
+	}
+}
+
+func TestErrorClassification(t *testing.T) {
+	for _, tc := range []struct {
+		name                          string
+		err                           error
+		notFound, conflict, planLimit bool
+	}{
+		{"nil", nil, false, false, false},
+		{"not api", errors.New("tunnel not found"), false, false, false},
+		{"404", &APIError{StatusCode: 404, Msg: "tunnel not found"}, true, false, false},
+		{"wrapped 404", fmt.Errorf("close: %w", &APIError{StatusCode: 404}), true, false, false},
+		{"409", &APIError{StatusCode: 409}, false, true, false},
+		{"already exists", &APIError{StatusCode: 400, Msg: "tunnel 'web' already exists"}, false, true, false},
+		{"already exists detail", &APIError{StatusCode: 400, Details: Map{"err": "Tunnel web Already Exists"}}, false, true, false},
+		{"402", &APIError{StatusCode: 402}, false, false, true},
+		{"session limit", &APIError{StatusCode: 502, Details: Map{"err": "Your account is limited to 1 simultaneous ngrok client session."}}, false, false, true},
+		{"paid plan", &APIError{StatusCode: 400, Msg: "Custom subdomains are a feature on ngrok's paid plans."}, false, false, true},
+		{"upgrade", &APIError{StatusCode: 400, Msg: "Please upgrade your account to reserve addresses"}, false, false, true},
+		{"other 400", &APIError{StatusCode: 400, Msg: "invalid tunnel configuration"}, false, false, false},
+	} {
+		if got := IsNotFound(tc.err); got != tc.notFound {
+			t.Errorf("%s: IsNotFound = %t", tc.name, got)
+		}
+		if got := IsConflict(tc.err); got != tc.conflict {
+			t.Errorf("%s: IsConflict = %t", tc.name, got)
+		}
+		if got := IsPlanLimit(tc.err); got != tc.planLimit {
+			t.Errorf("%s: IsPlanLimit = %t", tc.name, got)
+		}
+	}
+}
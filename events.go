@@ -0,0 +1,90 @@
+package gongrok
+
+/*
+	Copyright 2021 revzim.
+
+	Permission is hereby granted, free of charge, to any person obtaining a
+	copy of this software and associated documentation files (the "Software"),
+	to deal in the Software without restriction, including without limitation
+	the rights to use, copy, modify, merge, publish, distribute, sublicense,
+	and/or sell copies of the Software, and to permit persons to whom the Software
+	is furnished to do so, subject to the following conditions:
+
+	The above copyright notice and this permission notice shall be included
+	in all copies or substantial portions of the Software.
+
+	THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND,
+	EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES
+	OF MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT.
+	IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM,
+	DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE,
+	ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER
+	DEALINGS IN THE SOFTWARE.
+
+*/
+import (
+	"sync"
+	"time"
+)
+
+// EVENT TYPES
+const (
+	EventClientStarted    EventType = "client.started"     // AGENT API READY
+	EventClientExited     EventType = "client.exited"      // NGROK PROCESS EXITED
+	EventTunnelCreated    EventType = "tunnel.created"     // TUNNEL CREATED ON AGENT
+	EventTunnelDraining   EventType = "tunnel.draining"    // TUNNEL WAITING FOR OPEN CONNECTIONS BEFORE CLOSE
+	EventTunnelClosed     EventType = "tunnel.closed"      // TUNNEL CLOSED ON AGENT
+	EventTunnelURLChanged EventType = "tunnel.url_changed" // TUNNEL RE-CREATED W/ A NEW PUBLIC URL
+	EventTunnelUnhealthy  EventType = "tunnel.unhealthy"   // HEALTH CHECK FAILED
+	EventTunnelExpired    EventType = "tunnel.expired"     // MaxLifetime OR IdleTimeout PASSED, TUNNEL IS BEING CLOSED
+)
+
+var (
+	subscribers   = make(map[int]func(Event))
+	subscribersID int
+	subscribersMu sync.RWMutex
+)
+
+// Subscribe -
+// CALL FN FOR EVERY CLIENT & TUNNEL EVENT FROM ANY CLIENT
+// FN RUNS ON THE EMITTING GOROUTINE & MUST NOT BLOCK
+// RETURNS FUNC TO UNSUBSCRIBE
+func Subscribe(fn func(Event)) func() {
+	subscribersMu.Lock()
+	defer subscribersMu.Unlock()
+	subscribersID++
+	id := subscribersID
+	subscribers[id] = fn
+	return func() {
+		subscribersMu.Lock()
+		defer subscribersMu.Unlock()
+		delete(subscribers, id)
+	}
+}
+
+// emit -
+// SEND EVENT TO SUBSCRIBERS, TUNNEL IS COPIED
+func (c *Client) emit(typ EventType, t *Tunnel, previousURL string) {
+	c.publish(Event{Type: typ, PreviousURL: previousURL}, t)
+}
+
+// publish -
+// SEND e TO SUBSCRIBERS, FILLING ClientID, Time & A COPY OF TUNNEL
+// CALLER MUST NOT HOLD c.mu
+func (c *Client) publish(e Event, t *Tunnel) {
+	subscribersMu.RLock()
+	defer subscribersMu.RUnlock()
+	if len(subscribers) < 1 {
+		return
+	}
+	e.ClientID = c.ID
+	e.Time = time.Now()
+	if t != nil {
+		c.mu.RLock()
+		e.Tunnel = t.snapshot()
+		c.mu.RUnlock()
+	}
+	for _, fn := range subscribers {
+		fn(e)
+	}
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/labstack/echo"
+
+	"github.com/revzim/gongrok"
+)
+
+const (
+	metricsInterval = 5 * time.Second // TIME BETWEEN METRICS SNAPSHOTS
+)
+
+type (
+	// sseMessage -
+	// ONE SERVER-SENT EVENT
+	sseMessage struct {
+		Event string
+		Data  interface{}
+	}
+
+	// metricsSnapshot -
+	// METRICS FOR ONE TUNNEL
+	metricsSnapshot struct {
+		ClientID string           `json:"clientid"`
+		Tunnel   string           `json:"tunnel"`
+		Metrics  *gongrok.Metrics `json:"metrics"`
+		Time     time.Time        `json:"time"`
+	}
+)
+
+// handleEvents -
+// STREAM CLIENT & TUNNEL LIFECYCLE EVENTS & PERIODIC METRICS OVER SSE
+func handleEvents(c echo.Context) error {
+	res := c.Response()
+	flusher, ok := res.Writer.(http.Flusher)
+	if !ok {
+		return c.JSON(http.StatusInternalServerError, echo.Map{"error": "streaming unsupported"})
+	}
+	res.Header().Set(echo.HeaderContentType, "text/event-stream")
+	res.Header().Set("Cache-Control", "no-cache")
+	res.Header().Set("Connection", "keep-alive")
+	res.WriteHeader(http.StatusOK)
+
+	messages := make(chan sseMessage, 64)
+	send := func(msg sseMessage) {
+		select {
+		case messages <- msg:
+		default:
+			// SLOW BROWSER, DROP
+		}
+	}
+	unsubscribe := gongrok.Subscribe(func(e gongrok.Event) {
+		if e.Tunnel != nil {
+			e.Tunnel = scrubTunnel(e.Tunnel)
+		}
+		send(sseMessage{Event: string(e.Type), Data: e})
+	})
+	defer unsubscribe()
+
+	// ONE METRICS POLL IN FLIGHT AT A TIME, TICKS WHILE IT RUNS ARE SKIPPED
+	polled := make(chan []metricsSnapshot, 1)
+	polling := false
+	ticker := time.NewTicker(metricsInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-c.Request().Context().Done():
+			return nil
+		case <-ticker.C:
+			if polling {
+				continue
+			}
+			polling = true
+			go func() {
+				polled <- metricsSnapshots()
+			}()
+		case snaps := <-polled:
+			polling = false
+			for _, snap := range snaps {
+				send(sseMessage{Event: "metrics", Data: snap})
+			}
+		case msg := <-messages:
+			data, err := json.Marshal(msg.Data)
+			if err != nil {
+				continue
+			}
+			if _, err := fmt.Fprintf(res, "event: %s\ndata: %s\n\n", msg.Event, data); err != nil {
+				return nil
+			}
+			flusher.Flush()
+		}
+	}
+}
+
+// metricsSnapshots -
+// CURRENT METRICS FOR EVERY CREATED TUNNEL
+func metricsSnapshots() []metricsSnapshot {
+	snaps := make([]metricsSnapshot, 0)
+	for _, client := range manager.Clients() {
+		for _, t := range client.Snapshot() {
+			if !t.IsCreated {
+				continue
+			}
+			metrics, err := client.TunnelMetrics(t.Name)
+			if err != nil {
+				continue
+			}
+			snaps = append(snaps, metricsSnapshot{ClientID: client.ID, Tunnel: t.Name, Metrics: metrics, Time: time.Now()})
+		}
+	}
+	return snaps
+}
+
+// scrubTunnel -
+// COPY OF TUNNEL W/O AUTH
+func scrubTunnel(t *gongrok.Tunnel) *gongrok.Tunnel {
+	cp := *t
+	cp.Auth = ""
+	return &cp
+}
@@ -1,23 +1,30 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"net/http"
+	"os"
+	"path/filepath"
 	"strconv"
-	"sync"
 	"time"
 
 	"github.com/labstack/echo"
 
 	"github.com/revzim/gongrok"
+	"github.com/revzim/gongrok/server"
 )
 
 type (
 	str string
 )
 
+const (
+	stateDir = "./state" // SAVED CLIENT STATE, RESTORED ON START
+)
+
 var (
-	clients map[string]*gongrok.Client
+	manager = gongrok.NewManager(0) // CLIENTS SHARED W/ THE REST API
 )
 
 func handleDisconnectTunnel(c echo.Context) error {
@@ -27,9 +34,8 @@ func handleDisconnectTunnel(c echo.Context) error {
 		gongrok.Logger.Printf("handleDisconnectTunnel >>> Attemping to disconnect client | tunnel: %s | %s\n", clientID, tunnelName)
 	}
 
-	var client *gongrok.Client
-	var ok bool
-	if client, ok = clients[clientID]; !ok {
+	client, ok := manager.Client(clientID)
+	if !ok {
 		return c.JSON(http.StatusOK, echo.Map{
 			"error": fmt.Errorf("No client with id %s exists", clientID),
 			"code":  200,
@@ -39,22 +45,19 @@ func handleDisconnectTunnel(c echo.Context) error {
 	if gongrok.Settings.ShouldLog {
 		gongrok.Logger.Printf("Client %s exists\nRemoving tunnel %s...", clientID, tunnelName)
 	}
-	for i := range client.Tunnels {
-		if client.Tunnels[i].Name == tunnelName {
-			removedTunnel := client.Tunnels[i]
-			err := client.DisconnectTunnel(tunnelName)
-			if err != nil {
-				return c.JSON(http.StatusOK, echo.Map{
-					"error": err,
-					"code":  200,
-				})
-			}
+	if removedTunnel := client.FindTunnel(tunnelName); removedTunnel != nil {
+		err := client.DisconnectTunnel(tunnelName)
+		if err != nil {
 			return c.JSON(http.StatusOK, echo.Map{
-				"code":    200,
-				"status":  "OK",
-				"removed": removedTunnel,
+				"error": err,
+				"code":  200,
 			})
 		}
+		return c.JSON(http.StatusOK, echo.Map{
+			"code":    200,
+			"status":  "OK",
+			"removed": scrubTunnel(removedTunnel),
+		})
 	}
 	return c.JSON(http.StatusFound, echo.Map{
 		"error":  fmt.Errorf("tunnel %s does not belong to %s", tunnelName, clientID),
@@ -68,27 +71,15 @@ func handleDisconnectClient(c echo.Context) error {
 	if gongrok.Settings.ShouldLog {
 		gongrok.Logger.Printf("handleDisconnectClient >>> Attemping to disconnect client: %s\n", clientID)
 	}
-	if _, ok := clients[clientID]; ok {
-		if gongrok.Settings.ShouldLog {
-			gongrok.Logger.Printf("Client %s exists\nRemoving...", clientID)
-		}
-		err := clients[clientID].DisconnectAll()
-		if err != nil {
-			return c.JSON(http.StatusOK, echo.Map{
-				"error": err,
-				"code":  200,
-			})
-		}
-	}
-
-	err := clients[clientID].Close()
+	err := manager.CloseClient(clientID)
 	if err != nil {
 		return c.JSON(http.StatusOK, echo.Map{
-			"error":  err,
+			"error":  err.Error(),
 			"code":   200,
 			"status": "FAIL",
 		})
 	}
+	os.Remove(statePath(clientID))
 	return c.JSON(http.StatusOK, echo.Map{
 		"code":   200,
 		"status": "OK",
@@ -96,17 +87,10 @@ func handleDisconnectClient(c echo.Context) error {
 }
 
 func handleNewClient(c echo.Context) error {
-	protocolstr := str(c.FormValue("protocol"))
-	protocol, err := protocolstr.toInt()
+	protocol, err := gongrok.ParseProtocol(c.FormValue("protocol"))
 	if err != nil {
 		return c.JSON(http.StatusOK, echo.Map{
-			"error": err,
-			"code":  200,
-		})
-	}
-	if checkProtocol(protocol) {
-		return c.JSON(http.StatusOK, echo.Map{
-			"error": fmt.Sprintf("client sent bad protocol: %d", protocol),
+			"error": fmt.Sprintf("client sent bad protocol: %s", err),
 			"code":  200,
 		})
 	}
@@ -125,42 +109,35 @@ func handleNewClient(c echo.Context) error {
 		gongrok.Logger.Println("port:", port, "protocol:", protocol, "host:", hostname, "tunnelname:", clientname)
 	}
 	tunnel := &gongrok.Tunnel{
-		Proto:        gongrok.Protocol(protocol),
+		Proto:        protocol,
 		Name:         clientname,
 		LocalAddress: fmt.Sprintf("%s:%d", hostname, port),
 		Auth:         "",
 	}
 
-	client, err := gongrok.NewClient(gongrok.Options{
+	client, err := manager.NewClient(gongrok.Options{
 		LogNGROK: true,
 	})
 	if err != nil {
-		if gongrok.Settings.ShouldLog {
-			gongrok.Logger.Fatal(err)
-		}
 		return c.JSON(http.StatusOK, echo.Map{
-			"error": err,
+			"error": err.Error(),
 			"code":  200,
 		})
 	}
 
-	wg := &sync.WaitGroup{}
-	wg.Add(1)
-	go func(wg *sync.WaitGroup) {
-		err := client.StartNGROK(wg)
-		if err != nil {
-			if gongrok.Settings.ShouldLog {
-				gongrok.Logger.Println("server err:", err, " (*disregard if EOF*)")
-			}
-		}
-	}(wg)
-	wg.Wait()
-
-	client.AddTunnel(tunnel)
+	err = client.AddTunnel(tunnel)
+	if err != nil {
+		manager.CloseClient(client.ID)
+		return c.JSON(http.StatusOK, echo.Map{
+			"error": err.Error(),
+			"code":  200,
+		})
+	}
 
 	err = client.ConnectAll()
 
 	if err != nil {
+		manager.CloseClient(client.ID)
 		return c.JSON(http.StatusOK, echo.Map{
 			"error": err,
 			"code":  200,
@@ -169,7 +146,9 @@ func handleNewClient(c echo.Context) error {
 	if gongrok.Settings.ShouldLog {
 		gongrok.Logger.Printf("CLIENT CONNECTED: %+v\n", client)
 	}
-	clients[client.ID] = client
+	if err := client.SaveState(statePath(client.ID)); err != nil {
+		gongrok.Logger.Println("save state err:", err)
+	}
 
 	return c.JSON(http.StatusOK, echo.Map{
 		"tunnel": tunnel,
@@ -178,20 +157,6 @@ func handleNewClient(c echo.Context) error {
 
 }
 
-func checkProtocol(protocol int) bool {
-	switch protocol {
-	case 0:
-		fallthrough
-	case 1:
-		fallthrough
-	case 2:
-		return false
-	default:
-		break
-	}
-	return true
-}
-
 func (s str) toInt() (int, error) {
 	var err error
 	port, err := strconv.Atoi(string(s))
@@ -201,6 +166,33 @@ func (s str) toInt() (int, error) {
 	return port, err
 }
 
+func statePath(clientID string) string {
+	return filepath.Join(stateDir, clientID+".json")
+}
+
+// restoreClients -
+// RESTART CLIENTS SAVED BEFORE LAST SHUTDOWN
+func restoreClients() {
+	paths, err := filepath.Glob(filepath.Join(stateDir, "*.json"))
+	if err != nil {
+		return
+	}
+	for _, path := range paths {
+		client, err := gongrok.RestoreState(context.Background(), path)
+		if client == nil {
+			gongrok.Logger.Printf("restore %s err: %s\n", path, err)
+			continue
+		}
+		if err != nil {
+			gongrok.Logger.Printf("restore %s tunnels err: %s\n", path, err)
+		}
+		if err := manager.Add(client); err != nil {
+			gongrok.Logger.Printf("restore %s err: %s\n", path, err)
+			client.Close()
+		}
+	}
+}
+
 func handleClientHome(c echo.Context) error {
 	c.Response().Header().Add(echo.HeaderCookie, "POOP")
 	return c.File("./public/index.html")
@@ -208,15 +200,21 @@ func handleClientHome(c echo.Context) error {
 
 func main() {
 	// IF WANT TO WRITE TO FILE
-	clients = make(map[string]*gongrok.Client)
 	gongrok.Settings.LogAPI = true
 	gongrok.Settings.ShouldLog = true
 	gongrok.InitLoggerWriter("test")
+	restoreClients()
 	e := echo.New()
 
 	e.Logger.SetOutput(gongrok.Logger.Writer())
 	e.Static("/public", "public")
 	e.GET("/client", handleClientHome)
+	e.GET("/events", handleEvents)
+
+	// REST MANAGEMENT API
+	api := server.New(gongrok.Options{LogNGROK: true})
+	api.Manager = manager
+	e.Any("/api/*", echo.WrapHandler(http.StripPrefix("/api", api)))
 
 	e.POST("/client/new", handleNewClient)
 	e.POST("/client/disconnect", handleDisconnectClient)
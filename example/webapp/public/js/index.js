@@ -18,6 +18,10 @@ var app = new Vue({
     bools: {
       clientcreated: false,
     },
+    // LIVE UPDATES FROM /events
+    events: [],
+    metrics: {},
+    maxevents: 20,
     ngrok: {},
     ngrokmockdata: {
       client: {
@@ -141,11 +145,66 @@ var app = new Vue({
       }
       return { data: formData, keys: keys }
     },
+    listen() {
+      let source = new EventSource("/events");
+      let lifecycle = [
+        "client.started",
+        "client.exited",
+        "tunnel.created",
+        "tunnel.draining",
+        "tunnel.closed",
+        "tunnel.url_changed",
+        "tunnel.unhealthy",
+        "tunnel.expired",
+      ];
+      for (let type of lifecycle) {
+        source.addEventListener(type, (msg) => {
+          this.onLifecycle(JSON.parse(msg.data));
+        });
+      }
+      source.addEventListener("metrics", (msg) => {
+        let snap = JSON.parse(msg.data);
+        if (snap.clientid !== this.ngrok.data.client.id) {
+          return;
+        }
+        this.$set(this.metrics, snap.tunnel, snap.metrics);
+      });
+      source.onerror = (err) => {
+        console.log("events err:", err);
+      };
+    },
+    onLifecycle(e) {
+      this.events.unshift(e);
+      if (this.events.length > this.maxevents) {
+        this.events.pop();
+      }
+      if (!this.bools.clientcreated || e.clientid !== this.ngrok.data.client.id) {
+        return;
+      }
+      if (e.type === "client.exited") {
+        this.bools.clientcreated = false;
+        this.ngrok.data = this.ngrokmockdata;
+        return;
+      }
+      if (!e.tunnel) {
+        return;
+      }
+      // KEEP CURRENT TUNNEL & CLIENT TUNNEL LIST IN SYNC
+      if (this.ngrok.data.tunnel.name === e.tunnel.name) {
+        this.ngrok.data.tunnel = e.tunnel;
+      }
+      let tunnels = this.ngrok.data.client.tunnels || [];
+      let i = tunnels.findIndex((t) => t.name === e.tunnel.name);
+      if (i >= 0) {
+        this.$set(tunnels, i, e.tunnel);
+      }
+    },
   },
   mounted() {
     this.ngrok = {
       data: this.ngrokmockdata
     }
+    this.listen();
   },
 })
 
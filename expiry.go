@@ -0,0 +1,141 @@
+package gongrok
+
+/*
+	Copyright 2021 revzim.
+
+	Permission is hereby granted, free of charge, to any person obtaining a
+	copy of this software and associated documentation files (the "Software"),
+	to deal in the Software without restriction, including without limitation
+	the rights to use, copy, modify, merge, publish, distribute, sublicense,
+	and/or sell copies of the Software, and to permit persons to whom the Software
+	is furnished to do so, subject to the following conditions:
+
+	The above copyright notice and this permission notice shall be included
+	in all copies or substantial portions of the Software.
+
+	THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND,
+	EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES
+	OF MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT.
+	IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM,
+	DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE,
+	ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER
+	DEALINGS IN THE SOFTWARE.
+
+*/
+import (
+	"time"
+)
+
+// EXPIRY REASONS, SEE Event.Reason
+const (
+	ExpiredLifetime = "lifetime" // Tunnel.MaxLifetime PASSED
+	ExpiredIdle     = "idle"     // NO NEW CONNECTIONS FOR Tunnel.IdleTimeout
+)
+
+// watchExpiry -
+// START BACKGROUND WATCHER CLOSING TUNNEL ONCE MaxLifetime OR IdleTimeout PASSES
+// REPLACES ANY WATCHER FROM AN EARLIER CREATION OF THE SAME TUNNEL
+// CALLER MUST HOLD c.mu
+func (c *Client) watchExpiry(t *Tunnel) {
+	stopExpiry(t)
+	if t.MaxLifetime <= 0 && t.IdleTimeout <= 0 {
+		return
+	}
+	stop := make(chan struct{})
+	t.expiryStop = stop
+
+	maxLifetime, idleTimeout := time.Duration(t.MaxLifetime), time.Duration(t.IdleTimeout)
+	go func() {
+		var lifetime <-chan time.Time
+		if maxLifetime > 0 {
+			timer := time.NewTimer(maxLifetime)
+			defer timer.Stop()
+			lifetime = timer.C
+		}
+		var idle <-chan time.Time
+		if idleTimeout > 0 {
+			ticker := time.NewTicker(idleInterval(idleTimeout))
+			defer ticker.Stop()
+			idle = ticker.C
+		}
+
+		lastCount, lastActive := -1, time.Now()
+		for {
+			select {
+			case <-stop:
+				return
+			case <-c.Done():
+				return
+			case <-lifetime:
+				c.expire(t, stop, ExpiredLifetime)
+				return
+			case <-idle:
+				metrics, err := c.TunnelMetrics(t.Name)
+				if err != nil {
+					if IsNotFound(err) {
+						return
+					}
+					if Settings.ShouldLog {
+						Logger.Printf("idle check tunnel %s err: %s\n", t.Name, err)
+					}
+					continue
+				}
+				if metrics.Conns.Count != lastCount {
+					lastCount, lastActive = metrics.Conns.Count, time.Now()
+					continue
+				}
+				if time.Since(lastActive) >= idleTimeout {
+					c.expire(t, stop, ExpiredIdle)
+					return
+				}
+			}
+		}
+	}()
+}
+
+// stopExpiry -
+// STOP TUNNEL EXPIRY WATCHER IF RUNNING
+// CALLER MUST HOLD THE OWNING CLIENT'S mu
+func stopExpiry(t *Tunnel) {
+	if t.expiryStop != nil {
+		close(t.expiryStop)
+		t.expiryStop = nil
+	}
+}
+
+// expire -
+// NOTIFY & CLOSE EXPIRED TUNNEL
+// SKIPPED IF THE WATCHER OWNING stop WAS STOPPED OR REPLACED WHILE FIRING
+func (c *Client) expire(t *Tunnel, stop chan struct{}, reason string) {
+	c.mu.Lock()
+	if t.expiryStop != stop {
+		c.mu.Unlock()
+		return
+	}
+	t.expiryStop = nil
+	c.mu.Unlock()
+
+	if Settings.ShouldLog {
+		Logger.Printf("Tunnel %s expired (%s), closing...\n", t.Name, reason)
+	}
+	c.publish(Event{Type: EventTunnelExpired, Reason: reason}, t)
+	if err := c.CloseTunnel(t); err != nil && !IsNotFound(err) {
+		if Settings.ShouldLog {
+			Logger.Printf("close expired tunnel %s err: %s\n", t.Name, err)
+		}
+	}
+}
+
+// idleInterval -
+// TIME BETWEEN CONNECTION COUNT POLLS FOR IDLE TIMEOUT
+// QUARTER OF THE TIMEOUT, BETWEEN 1s & 30s
+func idleInterval(timeout time.Duration) time.Duration {
+	interval := timeout / 4
+	if interval < time.Second {
+		interval = time.Second
+	}
+	if interval > 30*time.Second {
+		interval = 30 * time.Second
+	}
+	return interval
+}
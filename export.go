@@ -0,0 +1,173 @@
+package gongrok
+
+/*
+	Copyright 2021 revzim.
+
+	Permission is hereby granted, free of charge, to any person obtaining a
+	copy of this software and associated documentation files (the "Software"),
+	to deal in the Software without restriction, including without limitation
+	the rights to use, copy, modify, merge, publish, distribute, sublicense,
+	and/or sell copies of the Software, and to permit persons to whom the Software
+	is furnished to do so, subject to the following conditions:
+
+	The above copyright notice and this permission notice shall be included
+	in all copies or substantial portions of the Software.
+
+	THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND,
+	EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES
+	OF MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT.
+	IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM,
+	DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE,
+	ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER
+	DEALINGS IN THE SOFTWARE.
+
+*/
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	envUnsafeRe = regexp.MustCompile(`[^A-Z0-9_]+`) // CHARS NOT ALLOWED IN ENV VAR NAMES
+)
+
+// ExportURLs -
+// WRITE TUNNEL PUBLIC URLS TO exp.EnvFile & exp.JSONFile WHENEVER THEY CHANGE
+// FILES ARE REPLACED ATOMICALLY BY A BACKGROUND WRITER, BURSTS OF CHANGES ARE COALESCED
+// RETURNS FUNC TO STOP EXPORTING, IT WAITS FOR THE LAST WRITE TO FINISH
+//
+// ENV FILE:
+//
+//	PUBLIC_URL=https://abc.ngrok.io
+//	PUBLIC_URL_WEB=https://abc.ngrok.io
+func ExportURLs(exp URLExport) func() {
+	if exp.Prefix == "" {
+		exp.Prefix = "PUBLIC_URL"
+	}
+	urls := make(map[string]string)
+	mu := &sync.Mutex{}
+	dirty := make(chan struct{}, 1)
+	done := make(chan struct{})
+
+	go func() {
+		defer close(done)
+		for range dirty {
+			mu.Lock()
+			snapshot := make(map[string]string, len(urls))
+			for name, url := range urls {
+				snapshot[name] = url
+			}
+			mu.Unlock()
+			if err := exp.write(snapshot); err != nil && Settings.ShouldLog {
+				Logger.Printf("export urls err: %s\n", err)
+			}
+		}
+	}()
+
+	unsubscribe := Subscribe(func(e Event) {
+		if e.Tunnel == nil {
+			return
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		switch e.Type {
+		case EventTunnelCreated, EventTunnelURLChanged:
+			if urls[e.Tunnel.Name] == e.Tunnel.RemoteAddress {
+				return
+			}
+			urls[e.Tunnel.Name] = e.Tunnel.RemoteAddress
+		case EventTunnelClosed:
+			if _, ok := urls[e.Tunnel.Name]; !ok {
+				return
+			}
+			delete(urls, e.Tunnel.Name)
+		default:
+			return
+		}
+		select {
+		case dirty <- struct{}{}:
+		default:
+			// WRITE ALREADY PENDING, IT WILL PICK UP THIS CHANGE
+		}
+	})
+	return func() {
+		unsubscribe()
+		close(dirty)
+		<-done
+	}
+}
+
+// ReadURLs -
+// TUNNEL NAME -> PUBLIC URL FROM A JSON FILE WRITTEN BY ExportURLs
+func ReadURLs(path string) (map[string]string, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	state := urlState{}
+	if err := json.Unmarshal(data, &state); err != nil {
+		return nil, fmt.Errorf("%s: %s", path, err)
+	}
+	if state.Tunnels == nil {
+		state.Tunnels = make(map[string]string)
+	}
+	return state.Tunnels, nil
+}
+
+// EnvName -
+// ENV VAR NAME FOR TUNNEL NAME, E.G. PUBLIC_URL + my-api -> PUBLIC_URL_MY_API
+func EnvName(prefix, name string) string {
+	return prefix + "_" + strings.Trim(envUnsafeRe.ReplaceAllString(strings.ToUpper(name), "_"), "_")
+}
+
+// write -
+// WRITE BOTH FILES FOR URLS
+func (exp *URLExport) write(urls map[string]string) error {
+	if exp.JSONFile != "" {
+		data, err := json.MarshalIndent(urlState{Version: 1, Updated: time.Now(), Tunnels: urls}, "", "  ")
+		if err != nil {
+			return err
+		}
+		if err := writeFileAtomic(exp.JSONFile, data, 0644); err != nil {
+			return err
+		}
+	}
+	if exp.EnvFile != "" {
+		if err := writeFileAtomic(exp.EnvFile, exp.env(urls), 0644); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// env -
+// .env FILE CONTENTS FOR URLS, SORTED BY NAME
+func (exp *URLExport) env(urls map[string]string) []byte {
+	names := make([]string, 0, len(urls))
+	for name := range urls {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	def := exp.Default
+	if def == "" && len(names) == 1 {
+		def = names[0]
+	}
+
+	buf := &bytes.Buffer{}
+	if url, ok := urls[def]; ok {
+		fmt.Fprintf(buf, "%s=%s\n", exp.Prefix, strconv.Quote(url))
+	}
+	for _, name := range names {
+		fmt.Fprintf(buf, "%s=%s\n", EnvName(exp.Prefix, name), strconv.Quote(urls[name]))
+	}
+	return buf.Bytes()
+}
@@ -23,7 +23,9 @@ package gongrok
 
 */
 import (
+	"bufio"
 	"bytes"
+	"context"
 	"errors"
 	"fmt"
 	"io"
@@ -33,6 +35,8 @@ import (
 	"os/signal"
 	"regexp"
 	"runtime"
+	"sort"
+	"strings"
 	"sync"
 	"syscall"
 	"time"
@@ -79,35 +83,29 @@ func ngrokBinExists() error {
 // NewClient -
 // INITS & RETURNS NEW CLIENT
 func NewClient(opt Options) (*Client, error) {
-	err := ngrokBinExists()
-	if err != nil {
-		log.Fatalf("no ngrok binary in path <Settings.Path>: %s", Settings.Path)
+	if opt.NGROKPath == "" {
+		if err := ngrokBinExists(); err != nil {
+			return nil, fmt.Errorf("no ngrok binary in path <Settings.Path>: %s", Settings.Path)
+		}
+		opt.NGROKPath = Settings.Path
+	} else if _, err := os.Stat(opt.NGROKPath); err != nil {
+		return nil, fmt.Errorf("no ngrok binary in path <Options.NGROKPath>: %s", opt.NGROKPath)
 	}
 	if Settings.ShouldLog {
 		Logger.Println("New client")
 	}
 
-	if opt.NGROKPath == "" {
-		opt.NGROKPath = Settings.Path
-	}
-
 	if opt.Region == "" {
 		opt.Region = "us"
 	}
 
-	if opt.AuthToken != "" {
-		err := opt.AuthTokenCommand()
-		if err != nil {
-			return nil, err
-		}
-	}
-
 	c := &Client{ID: uuid.New().String(), Options: &opt, LogAPI: Settings.LogAPI}
 	return c, nil
 }
 
 // AuthTokenCommand -
-// CMD USED IF AUTHENTICATION PROVIDED
+// SAVE AuthToken TO THE NGROK CONFIG AT CFGPath, OR THE USER'S GLOBAL CONFIG IF EMPTY
+// NOT NEEDED TO RUN CLIENTS, AuthToken IS PASSED TO EACH AGENT IN ITS OWN CONFIG
 func (o *Options) AuthTokenCommand() error {
 	if o.AuthToken == "" {
 		return errors.New("token missing")
@@ -121,7 +119,7 @@ func (o *Options) AuthTokenCommand() error {
 	commands = append(commands, []string{"authtoken", o.AuthToken}...)
 
 	if o.CFGPath != "" {
-		commands = append(commands, "--config"+o.CFGPath)
+		commands = append(commands, "--config", o.CFGPath)
 	}
 
 	cmd := exec.Command(o.NGROKPath, commands...)
@@ -129,13 +127,12 @@ func (o *Options) AuthTokenCommand() error {
 	cmd.Stdout = &outBuffer
 	cmd.Stderr = &errBuffer
 
-	if err := cmd.Start(); err != nil {
+	if err := cmd.Run(); err != nil {
+		if errBuffer.Len() > 0 {
+			return errors.New(strings.TrimSpace(errBuffer.String()))
+		}
 		return err
 	}
-
-	if errBuffer.String() != "" {
-		return errors.New(errBuffer.String())
-	}
 	if Settings.ShouldLog {
 		Logger.Println(outBuffer.String())
 	}
@@ -146,10 +143,29 @@ func (o *Options) AuthTokenCommand() error {
 // PARSE NGROK RESPONSE & CLOSE WAITGROUP ONCE RECVD
 // PAYLOAD THAT NGROK SERVER CLIENT READY
 func (c *Client) StartNGROK(wg *sync.WaitGroup) error {
+	c.ready = make(chan struct{})
+	c.done = make(chan struct{})
+	return c.startNGROK(wg)
+}
+
+// startNGROK -
+// RUN NGROK & PARSE OUTPUT UNTIL IT EXITS
+// ready & done CHANNELS MUST BE SET BY CALLER
+func (c *Client) startNGROK(wg *sync.WaitGroup) error {
 	if Settings.ShouldLog {
 		Logger.Println("Start server")
 	}
-	commands := c.Options.generateCommands()
+	cfgPath, err := c.writeConfig()
+	if err != nil {
+		if Settings.ShouldLog {
+			Logger.Printf("Write config err: %s", err.Error())
+		}
+		close(c.done)
+		return err
+	}
+	defer c.removeConfig()
+
+	commands := c.Options.generateCommands(cfgPath)
 	cmd := exec.Command(c.Options.NGROKPath, commands...)
 	c.runningCMDS = cmd
 	out, err := cmd.StdoutPipe()
@@ -157,8 +173,8 @@ func (c *Client) StartNGROK(wg *sync.WaitGroup) error {
 		if Settings.ShouldLog {
 			// Logger.Fatal(err)
 			Logger.Printf("Pipe cmd err: %s", err.Error())
-			return err
 		}
+		close(c.done)
 		return err
 	}
 
@@ -166,29 +182,128 @@ func (c *Client) StartNGROK(wg *sync.WaitGroup) error {
 		if Settings.ShouldLog {
 			// Logger.Fatal(err)
 			Logger.Printf("Start cmd err: %s", err.Error())
-			return err
 		}
+		close(c.done)
+		return err
 	}
 
 	// HANDLES SIGNAL INPUT
-	signalChan := make(chan os.Signal, 1)
-	signal.Notify(
-		signalChan, syscall.SIGHUP,
-		syscall.SIGINT, syscall.SIGTERM,
-		syscall.SIGQUIT)
-	go c.handleSignalInput(signalChan)
+	if Settings.HandleSignals {
+		signalChan := make(chan os.Signal, 1)
+		signal.Notify(
+			signalChan, syscall.SIGHUP,
+			syscall.SIGINT, syscall.SIGTERM,
+			syscall.SIGQUIT)
+		go c.handleSignalInput(signalChan)
+	}
 
 	// ATTEMPT TO INITIAILIZE NGROK CLIENT SERVER
 	err = handleInitNGROK(wg, c, out)
 
+	// OUTPUT ENDED OR NGROK FAILED, REAP PROCESS
+	if err != io.EOF {
+		cmd.Process.Kill()
+	}
+	cmd.Wait()
+	untrackAgent(c)
+	close(c.done)
+	c.emit(EventClientExited, nil, "")
+
 	if err != nil {
-		Logger.Println("handleInitNGROK error:", err)
+		if Settings.ShouldLog {
+			Logger.Println("handleInitNGROK error:", err)
+		}
 		return err
 	}
 
 	return nil
 }
 
+// Start -
+// STARTS NGROK IN THE BACKGROUND
+// BLOCKS UNTIL THE AGENT SESSION IS ESTABLISHED OR NGROK FAILS TO START
+// RETRIES W/ A NEW web_addr IF ANOTHER PROCESS TOOK THE ALLOCATED PORT
+// ON ErrSessionLimit, FAILS, QUEUES OR SHARES AN AGENT PER Options.SessionLimit
+func (c *Client) Start() error {
+	wait := time.Duration(c.Options.SessionWait)
+	if wait <= 0 {
+		wait = 5 * time.Minute
+	}
+	deadline := time.Now().Add(wait)
+	for {
+		err := c.startAgent()
+		if err != ErrSessionLimit {
+			return err
+		}
+		retry, err := c.admit(deadline)
+		if !retry {
+			return err
+		}
+	}
+}
+
+// startAgent -
+// START OWN AGENT
+func (c *Client) startAgent() error {
+	var err error
+	for i := 0; i < startAttempts; i++ {
+		if err = c.start(); err != ErrAddrInUse {
+			return err
+		}
+		if Settings.ShouldLog {
+			Logger.Println("web addr taken, retrying w/ new port")
+		}
+	}
+	return err
+}
+
+// start -
+// SINGLE Start ATTEMPT
+func (c *Client) start() error {
+	wg := &sync.WaitGroup{}
+	wg.Add(1)
+	c.ready = make(chan struct{})
+	c.done = make(chan struct{})
+	errChan := make(chan error, 1)
+	go func() {
+		errChan <- c.startNGROK(wg)
+	}()
+
+	select {
+	case <-c.ready:
+		return nil
+	case err := <-errChan:
+		if err == nil || err == io.EOF {
+			err = errors.New("ngrok exited before ready")
+		}
+		return err
+	}
+}
+
+// Done -
+// CLOSED ONCE THE NGROK PROCESS EXITS
+// NIL FOR CLIENTS THAT NEVER STARTED NGROK
+func (c *Client) Done() <-chan struct{} {
+	return c.done
+}
+
+// Alive -
+// IF NGROK PROCESS IS RUNNING, ATTACHED CLIENTS ARE ALWAYS ALIVE
+func (c *Client) Alive() bool {
+	if c.attached {
+		return true
+	}
+	if c.done == nil {
+		return false
+	}
+	select {
+	case <-c.done:
+		return false
+	default:
+		return true
+	}
+}
+
 // handleInitNGROK -
 // INIT REGEXES FOR NGROK CLIENT SERVER RESPONSE
 // IF REGEX PASSES, ATTEMPT TO PARSE RESPONSE
@@ -224,7 +339,14 @@ func handleInitNGROK(wg *sync.WaitGroup, c *Client, out io.ReadCloser) error {
 		}
 		return err
 	}
-	err = parseNGROK(wg, isNGReady, isLocalNGROKURI, isNGInUse, isNGSessionLimit, c, out)
+	isNGSession, err := regexp.Compile(ngSession)
+	if err != nil {
+		if Settings.ShouldLog {
+			Logger.Printf("check ngrok session err: %s\n", err.Error())
+		}
+		return err
+	}
+	err = parseNGROK(wg, isNGReady, isLocalNGROKURI, isNGInUse, isNGSessionLimit, isNGSession, c, out)
 	if err != nil {
 		if Settings.ShouldLog {
 			Logger.Printf("parse ngrok error: %s\n", err.Error())
@@ -237,59 +359,67 @@ func handleInitNGROK(wg *sync.WaitGroup, c *Client, out io.ReadCloser) error {
 // parseNGROK -
 // REGEX MATCHES & PARSES NGROK RESPONSE
 // ON SUCCESS, YIELDS NGROK CLIENT SERVER PUBLIC ADDR
-func parseNGROK(wg *sync.WaitGroup, isNGReady, isLocalNGURI, isNGInUse, isNGSessionLimit *regexp.Regexp, c *Client, out io.ReadCloser) error {
-
-	chunk := make([]byte, 256)
+func parseNGROK(wg *sync.WaitGroup, isNGReady, isLocalNGURI, isNGInUse, isNGSessionLimit, isNGSession *regexp.Regexp, c *Client, out io.ReadCloser) error {
+	started := false
+	reader := bufio.NewReader(out)
 	for {
-		n, err := out.Read(chunk)
-		if err != nil {
+		line, err := reader.ReadBytes('\n')
+		if err != nil && len(line) < 1 {
 			if Settings.ShouldLog {
 				Logger.Printf("check ngrok read err: %s", err.Error())
 			}
 			return err
 		}
 
-		if n < 1 {
-			continue
-		}
-
 		if c.Options.LogNGROK && Settings.ShouldLog {
-			Logger.Print("NGROK LOG: ", string(chunk[:n]))
+			Logger.Print("NGROK LOG: ", string(line))
 		}
 		// REGEX OUTPUT SEARCHES LOCAL IP & PORT FOR NGROK WEB UI
-		if isNGReady.Match(chunk[:n]) {
-			host := isLocalNGURI.FindStringSubmatch(string(chunk[:n]))
-			if len(host) >= 1 {
-				if Settings.ShouldLog {
-					Logger.Println("server client ready")
-				}
-				c.NGROKLocalAddr = host[0]
-				wg.Done()
+		if isNGReady.Match(line) {
+			if host := isLocalNGURI.FindString(string(line)); host != "" {
+				c.NGROKLocalAddr = host
 			}
 		}
-		if isNGInUse.Match(chunk[:n]) {
+		// READY ONLY ONCE THE TUNNEL SESSION IS UP, SESSION LIMIT ERRORS COME AFTER THE WEB SERVICE LINE
+		if !started && c.NGROKLocalAddr != "" && isNGSession.Match(line) {
 			if Settings.ShouldLog {
-				Logger.Printf("ngrok addr already in use: %s", err.Error())
+				Logger.Println("server client ready")
+			}
+			started = true
+			wg.Done()
+			close(c.ready)
+			trackAgent(c)
+			c.emit(EventClientStarted, nil, "")
+		}
+		if isNGInUse.Match(line) {
+			if Settings.ShouldLog {
+				Logger.Printf("ngrok addr already in use")
 
 			}
-			return err
+			return ErrAddrInUse
 		}
-		if isNGSessionLimit.Match(chunk[:n]) {
+		if isNGSessionLimit.Match(line) {
 			if Settings.ShouldLog {
 				Logger.Printf("ngrok session limit reached")
 			}
-			return errors.New("ngrok session limit reached")
+			return ErrSessionLimit
 		}
 	}
 }
 
 // generateCommands -
 // RETURNS COMMANDS TO START NGROK BIN
-func (o *Options) generateCommands() []string {
+// clientCFG IS LAYERED OVER CFGPath, LATER CONFIGS WIN
+func (o *Options) generateCommands(clientCFG string) []string {
 	cmds := []string{"start", "--none", "--log=stdout", fmt.Sprintf("--region=%s", o.Region)}
 
 	if o.CFGPath != "" {
-		cmds = append(cmds, fmt.Sprintf("--cfg=%s", o.CFGPath))
+		cmds = append(cmds, fmt.Sprintf("--config=%s", o.CFGPath))
+	} else if def := defaultConfigPath(); def != "" && clientCFG != "" {
+		cmds = append(cmds, fmt.Sprintf("--config=%s", def))
+	}
+	if clientCFG != "" {
+		cmds = append(cmds, fmt.Sprintf("--config=%s", clientCFG))
 	}
 	if o.SubDomain != "" {
 		cmds = append(cmds, fmt.Sprintf("--subdomain=%s", o.SubDomain))
@@ -315,31 +445,121 @@ func (c *Client) handleSignalInput(signalChan chan os.Signal) {
 }
 
 // AddTunnel -
-// INIT NEW TUNNEL
-func (c *Client) AddTunnel(t *Tunnel) {
+// VALIDATE & INIT NEW TUNNEL
+func (c *Client) AddTunnel(t *Tunnel) error {
 	if Settings.ShouldLog {
 		Logger.Println("Add tunnel")
 	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err := c.validateTunnel(t); err != nil {
+		return err
+	}
 	c.Tunnels = append(c.Tunnels, t)
+	return nil
+}
+
+// RemoveTunnel -
+// DROP TUNNEL NAME FROM CLIENT W/O CLOSING IT
+func (c *Client) RemoveTunnel(name string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for i, t := range c.Tunnels {
+		if t.Name == name {
+			c.Tunnels = append(c.Tunnels[:i], c.Tunnels[i+1:]...)
+			return
+		}
+	}
+}
+
+// Snapshot -
+// COPIES OF ALL CLIENT TUNNELS, SAFE TO READ WHILE HEALTH CHECKS, EXPIRY OR DRAINS RUN
+func (c *Client) Snapshot() []*Tunnel {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	tunnels := make([]*Tunnel, 0, len(c.Tunnels))
+	for _, t := range c.Tunnels {
+		tunnels = append(tunnels, t.snapshot())
+	}
+	return tunnels
+}
+
+// FindTunnel -
+// COPY OF CLIENT TUNNEL W/ NAME, NIL IF NONE
+func (c *Client) FindTunnel(name string) *Tunnel {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	if t := c.findTunnel(name); t != nil {
+		return t.snapshot()
+	}
+	return nil
+}
+
+// findTunnel -
+// CLIENT TUNNEL W/ NAME OR NIL
+// CALLER MUST HOLD c.mu
+func (c *Client) findTunnel(name string) *Tunnel {
+	for _, t := range c.Tunnels {
+		if t.Name == name {
+			return t
+		}
+	}
+	return nil
+}
+
+// tunnels -
+// COPY OF THE Tunnels SLICE, THE TUNNELS THEMSELVES ARE SHARED
+func (c *Client) tunnels() []*Tunnel {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	tunnels := make([]*Tunnel, len(c.Tunnels))
+	copy(tunnels, c.Tunnels)
+	return tunnels
+}
+
+// isCreated -
+// IF TUNNEL IS CREATED ON THE AGENT
+func (c *Client) isCreated(t *Tunnel) bool {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return t.IsCreated
 }
 
 // ConnectAll -
 // CONNECT ALL TUNNELS FOR CLIENT
+// RETURNS *MultiError MAPPING EACH TUNNEL NAME TO ITS RESULT IF ANY TUNNEL FAILED
+// IF Options.AllOrNothing IS SET, TUNNELS CREATED DURING THE CALL ARE CLOSED ON FAILURE
 func (c *Client) ConnectAll() error {
+	return c.connectAll(context.Background())
+}
+
+// connectAll -
+// ConnectAll W/ CTX, TUNNELS NOT YET CREATED WHEN CTX ENDS FAIL W/ ctx.Err()
+func (c *Client) connectAll(ctx context.Context) error {
 	wg := &sync.WaitGroup{}
 	// NGROK TUNNELS API REQUESTS POST TO API/TUNNELS
 	if Settings.ShouldLog {
 		Logger.Println("Connecting")
 	}
-	if len(c.Tunnels) < 1 {
+	tunnels := c.tunnels()
+	if len(tunnels) < 1 {
 		return errors.New("client currently has 0 tunnels")
 	}
 
-	for _, tunnel := range c.Tunnels {
-		if !tunnel.IsCreated {
+	mu := &sync.Mutex{}
+	results := make(map[string]error)
+	created := make([]*Tunnel, 0)
+	for _, tunnel := range tunnels {
+		if !c.isCreated(tunnel) {
 			wg.Add(1)
 			go func(tunnel *Tunnel) {
-				c.InitTunnel(tunnel)
+				err := c.createTunnel(ctx, tunnel)
+				mu.Lock()
+				results[tunnel.Name] = err
+				if err == nil {
+					created = append(created, tunnel)
+				}
+				mu.Unlock()
 				wg.Done()
 			}(tunnel)
 
@@ -347,27 +567,55 @@ func (c *Client) ConnectAll() error {
 	}
 
 	wg.Wait()
-	return nil
+
+	merr := &MultiError{Results: results}
+	if !merr.failed() {
+		return nil
+	}
+
+	if c.Options.AllOrNothing {
+		// ROLLBACK TUNNELS CREATED DURING THIS CALL
+		for _, tunnel := range created {
+			wg.Add(1)
+			go func(tunnel *Tunnel) {
+				err := c.CloseTunnel(tunnel)
+				mu.Lock()
+				if err != nil {
+					if Settings.ShouldLog {
+						Logger.Printf("rollback tunnel %s err: %s\n", tunnel.Name, err)
+					}
+					if merr.RollbackFailed == nil {
+						merr.RollbackFailed = make(map[string]error)
+					}
+					merr.RollbackFailed[tunnel.Name] = err
+				} else {
+					merr.RolledBack = append(merr.RolledBack, tunnel.Name)
+				}
+				mu.Unlock()
+				wg.Done()
+			}(tunnel)
+		}
+		wg.Wait()
+		sort.Strings(merr.RolledBack)
+	}
+
+	return merr
 }
 
 // DisconnectTunnel -
 // DISCONNECT SPECIFIED TUNNEL NAME FROM CLIENT
 func (c *Client) DisconnectTunnel(name string) error {
-	wg := &sync.WaitGroup{}
 	if Settings.ShouldLog {
 		Logger.Println("Disconnecting")
 	}
-	if len(c.Tunnels) < 1 {
+	tunnels := c.tunnels()
+	if len(tunnels) < 1 {
 		return errors.New("client currently has 0 tunnels")
 	}
 
-	for _, clientTunnel := range c.Tunnels {
-		if clientTunnel.IsCreated && clientTunnel.Name == name {
-			wg.Add(1)
-			go func() {
-				c.CloseTunnel(clientTunnel)
-				wg.Done()
-			}()
+	for _, clientTunnel := range tunnels {
+		if clientTunnel.Name == name && c.isCreated(clientTunnel) {
+			return c.CloseTunnel(clientTunnel)
 		}
 	}
 	return nil
@@ -375,38 +623,86 @@ func (c *Client) DisconnectTunnel(name string) error {
 
 // DisconnectAll -
 // DISCONNECT ALL CLIENT TUNNELS
+// RETURNS *MultiError MAPPING EACH TUNNEL NAME TO ITS RESULT IF ANY TUNNEL FAILED
 func (c *Client) DisconnectAll() error {
 	wg := &sync.WaitGroup{}
 	//	api request delete to /api/tunnels/:Name
 	if Settings.ShouldLog {
 		Logger.Println("Disconnecting...")
 	}
-	if len(c.Tunnels) < 1 {
+	tunnels := c.tunnels()
+	if len(tunnels) < 1 {
 		return errors.New("client currently has 0 tunnels")
 	}
 
-	for _, t := range c.Tunnels {
-		if t.IsCreated {
+	mu := &sync.Mutex{}
+	results := make(map[string]error)
+	for _, t := range tunnels {
+		if c.isCreated(t) {
 			wg.Add(1)
-			go func() {
-				c.CloseTunnel(t)
+			go func(t *Tunnel) {
+				err := c.CloseTunnel(t)
+				mu.Lock()
+				results[t.Name] = err
+				mu.Unlock()
 				wg.Done()
-			}()
+			}(t)
 		}
 	}
 
 	wg.Wait()
-	return nil
+
+	merr := &MultiError{Results: results}
+	if !merr.failed() {
+		return nil
+	}
+	return merr
 }
 
 // Close -
 // CLOSE & KILL NGROK CMD
+// ATTACHED CLIENTS ONLY DETACH, THE AGENT KEEPS RUNNING
+// CLIENTS SHARING AN AGENT CLOSE THEIR OWN TUNNELS & DETACH
 func (c *Client) Close() error {
+	c.StopHealthCheck()
+	c.mu.Lock()
+	for _, t := range c.Tunnels {
+		stopExpiry(t)
+	}
+	c.mu.Unlock()
+	if c.host != nil {
+		if Settings.ShouldLog {
+			Logger.Printf("Leaving shared agent %s\n", c.NGROKLocalAddr)
+		}
+		return c.closeShared()
+	}
+	if c.attached {
+		if Settings.ShouldLog {
+			Logger.Printf("Detaching from agent %s\n", c.NGROKLocalAddr)
+		}
+		return nil
+	}
+	defer c.removeConfig()
+	if c.runningCMDS == nil || c.runningCMDS.Process == nil {
+		return errors.New("ngrok process not started")
+	}
 	return c.runningCMDS.Process.Kill()
 }
 
 // Signal -
 // HANDLE SIGINPUT
 func (c *Client) Signal(signal os.Signal) error {
+	if c.attached || c.host != nil {
+		return errors.New("cannot signal attached agent")
+	}
+	if c.runningCMDS == nil || c.runningCMDS.Process == nil {
+		return errors.New("ngrok process not started")
+	}
 	return c.runningCMDS.Process.Signal(signal)
 }
+
+// IsAttached -
+// IF CLIENT IS BOUND TO AN AGENT IT DID NOT START
+func (c *Client) IsAttached() bool {
+	return c.attached || c.host != nil
+}
@@ -0,0 +1,165 @@
+package gongrok
+
+/*
+	Copyright 2021 revzim.
+
+	Permission is hereby granted, free of charge, to any person obtaining a
+	copy of this software and associated documentation files (the "Software"),
+	to deal in the Software without restriction, including without limitation
+	the rights to use, copy, modify, merge, publish, distribute, sublicense,
+	and/or sell copies of the Software, and to permit persons to whom the Software
+	is furnished to do so, subject to the following conditions:
+
+	The above copyright notice and this permission notice shall be included
+	in all copies or substantial portions of the Software.
+
+	THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND,
+	EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES
+	OF MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT.
+	IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM,
+	DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE,
+	ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER
+	DEALINGS IN THE SOFTWARE.
+
+*/
+import (
+	"net"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// StartHealthCheck -
+// PERIODICALLY CONFIRM CLIENT TUNNELS STILL EXIST ON THE AGENT
+// MISSING TUNNELS ARE MARKED UNHEALTHY & RE-CREATED
+// REPLACES ANY RUNNING HEALTH CHECKER
+func (c *Client) StartHealthCheck(hc HealthCheck) {
+	c.StopHealthCheck()
+	if hc.Interval <= 0 {
+		hc.Interval = 30 * time.Second
+	}
+	if hc.UpstreamTimeout <= 0 {
+		hc.UpstreamTimeout = 2 * time.Second
+	}
+	stop := make(chan struct{})
+	c.mu.Lock()
+	c.healthStop = stop
+	c.mu.Unlock()
+
+	go func() {
+		ticker := time.NewTicker(hc.Interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+				c.CheckHealth(hc)
+			}
+		}
+	}()
+}
+
+// StopHealthCheck -
+// STOP BACKGROUND HEALTH CHECKER IF RUNNING
+func (c *Client) StopHealthCheck() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.healthStop != nil {
+		close(c.healthStop)
+		c.healthStop = nil
+	}
+}
+
+// CheckHealth -
+// RUN ONE HEALTH CHECK OVER ALL CREATED TUNNELS
+// TUNNELS WHOSE RE-CREATE FAILED STAY IN THE CHECK SET & ARE RETRIED NEXT CHECK
+func (c *Client) CheckHealth(hc HealthCheck) {
+	live, err := c.ListTunnels()
+	if err != nil {
+		if Settings.ShouldLog {
+			Logger.Printf("health check list tunnels err: %s\n", err)
+		}
+		return
+	}
+	exists := make(map[string]bool)
+	for _, t := range live {
+		exists[t.Name] = true
+	}
+
+	now := time.Now()
+	for _, t := range c.tunnels() {
+		c.mu.Lock()
+		if !t.IsCreated && !t.desired {
+			c.mu.Unlock()
+			continue
+		}
+		t.LastCheck = now
+		t.Healthy = true
+		t.HealthErr = ""
+		missing := !exists[t.Name]
+		if missing {
+			t.Healthy = false
+			t.HealthErr = "tunnel missing from agent"
+			t.IsCreated = false
+			t.RemoteAddress = ""
+		}
+		c.mu.Unlock()
+
+		if missing {
+			if Settings.ShouldLog {
+				Logger.Printf("health check: tunnel %s missing, re-creating\n", t.Name)
+			}
+			c.emit(EventTunnelUnhealthy, t, "")
+			err := c.InitTunnel(t)
+			c.mu.Lock()
+			if err != nil {
+				t.HealthErr = "re-create failed: " + err.Error()
+			} else {
+				t.Healthy = true
+				t.HealthErr = ""
+			}
+			c.mu.Unlock()
+			if err != nil {
+				continue
+			}
+		}
+
+		if hc.ProbeUpstream {
+			conn, err := net.DialTimeout("tcp", dialAddr(t.LocalAddress), hc.UpstreamTimeout)
+			if err != nil {
+				c.mu.Lock()
+				t.Healthy = false
+				t.HealthErr = "upstream unreachable: " + err.Error()
+				c.mu.Unlock()
+				c.emit(EventTunnelUnhealthy, t, "")
+				continue
+			}
+			conn.Close()
+		}
+	}
+}
+
+// dialAddr -
+// CONVERT TUNNEL LocalAddress (PORT | HOST:PORT | URL) TO HOST:PORT
+func dialAddr(local string) string {
+	if strings.Contains(local, "://") {
+		if u, err := url.Parse(local); err == nil {
+			if u.Port() != "" {
+				return u.Host
+			}
+			if u.Scheme == "https" {
+				return net.JoinHostPort(u.Hostname(), "443")
+			}
+			return net.JoinHostPort(u.Hostname(), "80")
+		}
+	}
+	if !strings.Contains(local, ":") {
+		// PORT ONLY
+		if _, err := net.LookupPort("tcp", local); err == nil {
+			return net.JoinHostPort("localhost", local)
+		}
+		return net.JoinHostPort(local, "80")
+	}
+	return local
+}
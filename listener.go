@@ -0,0 +1,115 @@
+package gongrok
+
+/*
+	Copyright 2021 revzim.
+
+	Permission is hereby granted, free of charge, to any person obtaining a
+	copy of this software and associated documentation files (the "Software"),
+	to deal in the Software without restriction, including without limitation
+	the rights to use, copy, modify, merge, publish, distribute, sublicense,
+	and/or sell copies of the Software, and to permit persons to whom the Software
+	is furnished to do so, subject to the following conditions:
+
+	The above copyright notice and this permission notice shall be included
+	in all copies or substantial portions of the Software.
+
+	THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND,
+	EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES
+	OF MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT.
+	IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM,
+	DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE,
+	ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER
+	DEALINGS IN THE SOFTWARE.
+
+*/
+import (
+	"context"
+	"net"
+	"net/url"
+	"strings"
+
+	"github.com/google/uuid"
+)
+
+// Listen -
+// CREATE A TUNNEL OF PROTO FORWARDING TO A NEW LOOPBACK LISTENER
+// LISTENER & TUNNEL ARE CLOSED ON Close OR ONCE CTX ENDS
+func Listen(ctx context.Context, c *Client, proto Protocol) (*Listener, error) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, err
+	}
+
+	t := &Tunnel{
+		Proto:        proto,
+		Name:         "listener-" + uuid.New().String()[:8],
+		LocalAddress: ln.Addr().String(),
+	}
+	if err := c.AddTunnel(t); err != nil {
+		ln.Close()
+		return nil, err
+	}
+	if err := c.InitTunnel(t); err != nil {
+		c.RemoveTunnel(t.Name)
+		ln.Close()
+		return nil, err
+	}
+
+	l := &Listener{Listener: ln, Tunnel: t, client: c, closed: make(chan struct{})}
+	go func() {
+		select {
+		case <-ctx.Done():
+			l.Close()
+		case <-l.closed:
+		}
+	}()
+	return l, nil
+}
+
+// Addr -
+// PUBLIC ENDPOINT OF THE TUNNEL
+func (l *Listener) Addr() net.Addr {
+	l.client.mu.RLock()
+	defer l.client.mu.RUnlock()
+	return &PublicAddr{Proto: l.Tunnel.Proto, URL: l.Tunnel.RemoteAddress}
+}
+
+// Close -
+// CLOSE TUNNEL & UNDERLYING LISTENER
+// THE TUNNEL STAYS ON THE CLIENT IF THE AGENT FAILS TO CLOSE IT
+func (l *Listener) Close() error {
+	l.once.Do(func() {
+		close(l.closed)
+		l.err = l.client.CloseTunnel(l.Tunnel)
+		if l.err == nil || IsNotFound(l.err) {
+			l.err = nil
+			l.client.RemoveTunnel(l.Tunnel.Name)
+		}
+		if err := l.Listener.Close(); l.err == nil {
+			l.err = err
+		}
+	})
+	return l.err
+}
+
+// Network -
+// TUNNEL PROTOCOL NAME
+func (a *PublicAddr) Network() string {
+	return protocols[a.Proto]
+}
+
+// String -
+// HTTP TUNNELS REPORT THE FULL URL, TCP & TLS REPORT HOST:PORT
+func (a *PublicAddr) String() string {
+	if a.Proto == HTTP {
+		return a.URL
+	}
+	u, err := url.Parse(a.URL)
+	if err != nil || u.Host == "" {
+		return strings.TrimPrefix(a.URL, protocols[a.Proto]+"://")
+	}
+	if u.Port() == "" {
+		return net.JoinHostPort(u.Hostname(), "443")
+	}
+	return u.Host
+}
@@ -0,0 +1,197 @@
+package gongrok
+
+/*
+	Copyright 2021 revzim.
+
+	Permission is hereby granted, free of charge, to any person obtaining a
+	copy of this software and associated documentation files (the "Software"),
+	to deal in the Software without restriction, including without limitation
+	the rights to use, copy, modify, merge, publish, distribute, sublicense,
+	and/or sell copies of the Software, and to permit persons to whom the Software
+	is furnished to do so, subject to the following conditions:
+
+	The above copyright notice and this permission notice shall be included
+	in all copies or substantial portions of the Software.
+
+	THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND,
+	EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES
+	OF MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT.
+	IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM,
+	DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE,
+	ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER
+	DEALINGS IN THE SOFTWARE.
+
+*/
+import (
+	"errors"
+	"fmt"
+	"sort"
+)
+
+// NewManager -
+// INITS & RETURNS NEW MANAGER
+// maxAgents < 1 PUTS NO CAP ON RUNNING AGENTS
+func NewManager(maxAgents int) *Manager {
+	if maxAgents < 0 {
+		maxAgents = 0
+	}
+	return &Manager{MaxAgents: maxAgents, clients: make(map[string]*Client)}
+}
+
+// NewClient -
+// CREATE, START & TRACK A CLIENT
+// RETURNS ErrTooManyAgents IF MaxAgents ARE ALREADY RUNNING
+// NOTHING IS TRACKED OR LEFT RUNNING IF THE AGENT FAILS TO START
+func (m *Manager) NewClient(opt Options) (*Client, error) {
+	m.mu.Lock()
+	if m.closed {
+		m.mu.Unlock()
+		return nil, errors.New("manager closed")
+	}
+	if m.MaxAgents > 0 && m.agents()+m.starting >= m.MaxAgents {
+		m.mu.Unlock()
+		return nil, ErrTooManyAgents
+	}
+	m.starting++
+	m.mu.Unlock()
+
+	c, err := NewClient(opt)
+	if err == nil {
+		if err = c.Start(); err != nil {
+			c.Close()
+		}
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.starting--
+	if err != nil {
+		return nil, err
+	}
+	if m.closed {
+		closeManaged(c)
+		return nil, errors.New("manager closed")
+	}
+	m.track(c)
+	return c, nil
+}
+
+// Add -
+// TRACK A CLIENT CREATED ELSEWHERE, E.G. BY RestoreState OR Attach
+func (m *Manager) Add(c *Client) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.closed {
+		return errors.New("manager closed")
+	}
+	if _, ok := m.clients[c.ID]; ok {
+		return fmt.Errorf("client %s already managed", c.ID)
+	}
+	if !c.IsAttached() && m.MaxAgents > 0 && m.agents()+m.starting >= m.MaxAgents {
+		return ErrTooManyAgents
+	}
+	m.track(c)
+	return nil
+}
+
+// Client -
+// CLIENT W/ ID
+func (m *Manager) Client(id string) (*Client, bool) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	c, ok := m.clients[id]
+	return c, ok
+}
+
+// Clients -
+// EVERY MANAGED CLIENT SORTED BY ID
+func (m *Manager) Clients() []*Client {
+	m.mu.RLock()
+	clients := make([]*Client, 0, len(m.clients))
+	for _, c := range m.clients {
+		clients = append(clients, c)
+	}
+	m.mu.RUnlock()
+	sort.Slice(clients, func(i, j int) bool { return clients[i].ID < clients[j].ID })
+	return clients
+}
+
+// Remove -
+// STOP TRACKING CLIENT ID W/O CLOSING IT
+func (m *Manager) Remove(id string) (*Client, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	c, ok := m.clients[id]
+	delete(m.clients, id)
+	return c, ok
+}
+
+// CloseClient -
+// DISCONNECT TUNNELS, CLOSE & STOP TRACKING CLIENT ID
+func (m *Manager) CloseClient(id string) error {
+	c, ok := m.Remove(id)
+	if !ok {
+		return fmt.Errorf("no client %s", id)
+	}
+	return closeManaged(c)
+}
+
+// Close -
+// CLOSE EVERY CLIENT, NO NEW CLIENTS ARE ACCEPTED AFTERWARDS
+func (m *Manager) Close() error {
+	m.mu.Lock()
+	m.closed = true
+	clients := m.clients
+	m.clients = make(map[string]*Client)
+	m.mu.Unlock()
+
+	var err error
+	for _, c := range clients {
+		if cerr := closeManaged(c); cerr != nil && err == nil {
+			err = cerr
+		}
+	}
+	return err
+}
+
+// track -
+// ADD CLIENT & FORGET IT ONCE ITS AGENT EXITS
+// CALLER MUST HOLD m.mu
+func (m *Manager) track(c *Client) {
+	m.clients[c.ID] = c
+	if c.Done() == nil {
+		return
+	}
+	go func() {
+		<-c.Done()
+		m.mu.Lock()
+		defer m.mu.Unlock()
+		if m.clients[c.ID] == c {
+			delete(m.clients, c.ID)
+		}
+	}()
+}
+
+// agents -
+// RUNNING AGENTS OWNED BY MANAGED CLIENTS
+// CALLER MUST HOLD m.mu
+func (m *Manager) agents() int {
+	n := 0
+	for _, c := range m.clients {
+		if !c.IsAttached() {
+			n++
+		}
+	}
+	return n
+}
+
+// closeManaged -
+// BEST EFFORT DISCONNECT OF CLIENT TUNNELS, THEN CLOSE
+func closeManaged(c *Client) error {
+	if len(c.tunnels()) > 0 && c.Alive() {
+		if err := c.DisconnectAll(); err != nil && Settings.ShouldLog {
+			Logger.Printf("manager: disconnect client %s err: %s\n", c.ID, err)
+		}
+	}
+	return c.Close()
+}
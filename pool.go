@@ -0,0 +1,280 @@
+package gongrok
+
+/*
+	Copyright 2021 revzim.
+
+	Permission is hereby granted, free of charge, to any person obtaining a
+	copy of this software and associated documentation files (the "Software"),
+	to deal in the Software without restriction, including without limitation
+	the rights to use, copy, modify, merge, publish, distribute, sublicense,
+	and/or sell copies of the Software, and to permit persons to whom the Software
+	is furnished to do so, subject to the following conditions:
+
+	The above copyright notice and this permission notice shall be included
+	in all copies or substantial portions of the Software.
+
+	THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND,
+	EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES
+	OF MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT.
+	IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM,
+	DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE,
+	ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER
+	DEALINGS IN THE SOFTWARE.
+
+*/
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+// NewPool -
+// INITS & RETURNS NEW POOL
+// AGENTS ARE NOT STARTED UNTIL TUNNELS ARE ADDED
+func NewPool(opt Options, maxAgents, perAgent int) *Pool {
+	if maxAgents < 1 {
+		maxAgents = 1
+	}
+	if perAgent < 1 {
+		perAgent = 4
+	}
+	return &Pool{Options: opt, MaxAgents: maxAgents, PerAgent: perAgent, pending: make(map[string]bool)}
+}
+
+// AddTunnel -
+// PLACE & CONNECT TUNNEL ON AN AGENT W/ SPARE CAPACITY
+// STARTS A NEW AGENT IF ALL RUNNING AGENTS ARE FULL
+func (p *Pool) AddTunnel(t *Tunnel) error {
+	return p.place(t)
+}
+
+// RemoveTunnel -
+// CLOSE TUNNEL NAME & REMOVE IT FROM ITS AGENT
+// THE TUNNEL IS PUT BACK IF THE AGENT FAILS TO CLOSE IT
+func (p *Pool) RemoveTunnel(name string) error {
+	p.mu.Lock()
+	c, t := p.lookup(name)
+	if t == nil {
+		p.mu.Unlock()
+		return fmt.Errorf("no tunnel %s in pool", name)
+	}
+	c.RemoveTunnel(name)
+	p.mu.Unlock()
+
+	if c.isCreated(t) {
+		if err := c.CloseTunnel(t); err != nil && !IsNotFound(err) {
+			p.mu.Lock()
+			c.mu.Lock()
+			c.Tunnels = append(c.Tunnels, t)
+			c.mu.Unlock()
+			p.mu.Unlock()
+			return err
+		}
+	}
+	return nil
+}
+
+// Tunnels -
+// UNIFIED VIEW OF EVERY TUNNEL ACROSS ALL AGENTS, SEE Client.Snapshot
+func (p *Pool) Tunnels() []*Tunnel {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	tunnels := make([]*Tunnel, 0)
+	for _, c := range p.clients {
+		tunnels = append(tunnels, c.Snapshot()...)
+	}
+	return tunnels
+}
+
+// Lookup -
+// RETURNS AGENT & TUNNEL FOR TUNNEL NAME, NIL IF NOT IN POOL
+func (p *Pool) Lookup(name string) (*Client, *Tunnel) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.lookup(name)
+}
+
+// Clients -
+// RUNNING AGENTS IN POOL
+func (p *Pool) Clients() []*Client {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	clients := make([]*Client, len(p.clients))
+	copy(clients, p.clients)
+	return clients
+}
+
+// Rebalance -
+// DROP DEAD AGENTS & RE-CREATE THEIR TUNNELS ON LIVE ONES
+// RETURNS *MultiError FOR TUNNELS THAT COULD NOT BE PLACED
+func (p *Pool) Rebalance() error {
+	p.mu.Lock()
+	if p.closed {
+		p.mu.Unlock()
+		return nil
+	}
+
+	orphans := make([]*Tunnel, 0)
+	alive := make([]*Client, 0, len(p.clients))
+	for _, c := range p.clients {
+		if c.Alive() {
+			alive = append(alive, c)
+			continue
+		}
+		// RESET UNDER THE DEAD AGENT'S LOCK BEFORE HANDING TUNNELS TO place
+		c.mu.Lock()
+		if Settings.ShouldLog {
+			Logger.Printf("Pool agent %s died, moving %d tunnels\n", c.ID, len(c.Tunnels))
+		}
+		for _, t := range c.Tunnels {
+			stopExpiry(t)
+			t.IsCreated = false
+			t.RemoteAddress = ""
+		}
+		orphans = append(orphans, c.Tunnels...)
+		c.mu.Unlock()
+	}
+	p.clients = alive
+	p.mu.Unlock()
+
+	results := make(map[string]error)
+	for _, t := range orphans {
+		results[t.Name] = p.place(t)
+	}
+
+	merr := &MultiError{Results: results}
+	if !merr.failed() {
+		return nil
+	}
+	return merr
+}
+
+// Close -
+// CLOSE EVERY AGENT IN POOL
+func (p *Pool) Close() error {
+	p.mu.Lock()
+	p.closed = true
+	clients := p.clients
+	p.clients = nil
+	p.mu.Unlock()
+
+	var err error
+	for _, c := range clients {
+		if cerr := c.Close(); cerr != nil && err == nil {
+			err = cerr
+		}
+	}
+	return err
+}
+
+// place -
+// RESERVE A SLOT ON THE LEAST LOADED AGENT W/ SPARE CAPACITY, THEN CONNECT TUNNEL
+// p.mu IS ONLY HELD WHILE CHOOSING & RESERVING, AGENT START & TUNNEL CREATION RUN UNLOCKED
+// CALLER MUST NOT HOLD p.mu
+func (p *Pool) place(t *Tunnel) error {
+	p.mu.Lock()
+	if p.closed {
+		p.mu.Unlock()
+		return errors.New("pool closed")
+	}
+	if _, existing := p.lookup(t.Name); existing != nil || p.pending[t.Name] {
+		p.mu.Unlock()
+		return fmt.Errorf("tunnel %s already exists in pool", t.Name)
+	}
+
+	var target *Client
+	for _, c := range p.clients {
+		n := len(c.tunnels())
+		if !c.Alive() || n >= p.PerAgent {
+			continue
+		}
+		if target == nil || n < len(target.tunnels()) {
+			target = c
+		}
+	}
+
+	if target == nil {
+		if len(p.clients)+p.starting >= p.MaxAgents {
+			p.mu.Unlock()
+			return fmt.Errorf("pool at capacity: %d agents x %d tunnels", p.MaxAgents, p.PerAgent)
+		}
+		if p.pending == nil {
+			p.pending = make(map[string]bool)
+		}
+		p.starting++
+		p.pending[t.Name] = true
+		p.mu.Unlock()
+
+		c, err := p.startAgent()
+
+		p.mu.Lock()
+		p.starting--
+		delete(p.pending, t.Name)
+		if err != nil {
+			p.mu.Unlock()
+			return err
+		}
+		if p.closed {
+			p.mu.Unlock()
+			c.Close()
+			return errors.New("pool closed")
+		}
+		p.clients = append(p.clients, c)
+		go p.watch(c)
+		target = c
+	}
+
+	// RESERVE SLOT, VALIDATES NAME & FIELDS
+	if err := target.AddTunnel(t); err != nil {
+		p.mu.Unlock()
+		return err
+	}
+	p.mu.Unlock()
+
+	if err := target.initTunnel(context.Background(), t); err != nil {
+		p.mu.Lock()
+		target.RemoveTunnel(t.Name)
+		p.mu.Unlock()
+		return err
+	}
+	return nil
+}
+
+// startAgent -
+// START NEW AGENT
+// CALLER MUST NOT HOLD p.mu
+func (p *Pool) startAgent() (*Client, error) {
+	c, err := NewClient(p.Options)
+	if err != nil {
+		return nil, err
+	}
+	if err := c.Start(); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// watch -
+// REBALANCE ONCE AGENT EXITS
+func (p *Pool) watch(c *Client) {
+	<-c.Done()
+	if err := p.Rebalance(); err != nil {
+		if Settings.ShouldLog {
+			Logger.Printf("pool rebalance err: %s\n", err)
+		}
+	}
+}
+
+// lookup -
+// CALLER MUST HOLD p.mu
+func (p *Pool) lookup(name string) (*Client, *Tunnel) {
+	for _, c := range p.clients {
+		c.mu.RLock()
+		t := c.findTunnel(name)
+		c.mu.RUnlock()
+		if t != nil {
+			return c, t
+		}
+	}
+	return nil, nil
+}
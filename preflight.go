@@ -0,0 +1,113 @@
+package gongrok
+
+/*
+	Copyright 2021 revzim.
+
+	Permission is hereby granted, free of charge, to any person obtaining a
+	copy of this software and associated documentation files (the "Software"),
+	to deal in the Software without restriction, including without limitation
+	the rights to use, copy, modify, merge, publish, distribute, sublicense,
+	and/or sell copies of the Software, and to permit persons to whom the Software
+	is furnished to do so, subject to the following conditions:
+
+	The above copyright notice and this permission notice shall be included
+	in all copies or substantial portions of the Software.
+
+	THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND,
+	EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES
+	OF MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT.
+	IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM,
+	DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE,
+	ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER
+	DEALINGS IN THE SOFTWARE.
+
+*/
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// wait -
+// PROBE TUNNEL UPSTREAM UNTIL IT ACCEPTS CONNECTIONS OR TIMEOUT PASSES
+// HTTP TUNNELS W/ HTTPPath ARE READY ONCE GET RETURNS A NON-5XX STATUS
+// STOPS W/ ctx.Err() ONCE CTX ENDS
+func (p *Preflight) wait(ctx context.Context, t *Tunnel) error {
+	timeout := time.Duration(p.Timeout)
+	if timeout <= 0 {
+		timeout = 30 * time.Second
+	}
+	interval := time.Duration(p.Interval)
+	if interval <= 0 {
+		interval = 250 * time.Millisecond
+	}
+	probeTimeout := time.Duration(p.ProbeTimeout)
+	if probeTimeout <= 0 {
+		probeTimeout = 5 * time.Second
+	}
+
+	addr := dialAddr(t.LocalAddress)
+	probe := func(timeout time.Duration) error {
+		conn, err := net.DialTimeout("tcp", addr, timeout)
+		if err != nil {
+			return err
+		}
+		return conn.Close()
+	}
+	if t.Proto == HTTP && p.HTTPPath != "" {
+		probe = func(timeout time.Duration) error {
+			return probeHTTP(t.LocalAddress, p.HTTPPath, timeout)
+		}
+	}
+
+	if Settings.ShouldLog {
+		Logger.Printf("Waiting for upstream %s...\n", addr)
+	}
+	deadline := time.Now().Add(timeout)
+	for {
+		// NEVER WAIT ON A SINGLE PROBE PAST THE DEADLINE
+		limit := probeTimeout
+		if left := time.Until(deadline); left < limit {
+			limit = left
+		}
+		err := probe(limit)
+		if err == nil {
+			return nil
+		}
+		if time.Now().Add(interval).After(deadline) {
+			return fmt.Errorf("%w: %s after %s: %v", ErrUpstreamUnreachable, addr, timeout, err)
+		}
+		timer := time.NewTimer(interval)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+// probeHTTP -
+// GET PATH ON LOCAL ADDRESS, ERROR ON 5XX
+func probeHTTP(local, path string, timeout time.Duration) error {
+	scheme := "http"
+	if strings.HasPrefix(local, "https://") {
+		scheme = "https"
+	}
+	if !strings.HasPrefix(path, "/") {
+		path = "/" + path
+	}
+	client := &http.Client{Timeout: timeout}
+	res, err := client.Get(fmt.Sprintf("%s://%s%s", scheme, dialAddr(local), path))
+	if err != nil {
+		return err
+	}
+	res.Body.Close()
+	if res.StatusCode >= 500 {
+		return fmt.Errorf("status %d", res.StatusCode)
+	}
+	return nil
+}
@@ -0,0 +1,163 @@
+package gongrok
+
+/*
+	Copyright 2021 revzim.
+
+	Permission is hereby granted, free of charge, to any person obtaining a
+	copy of this software and associated documentation files (the "Software"),
+	to deal in the Software without restriction, including without limitation
+	the rights to use, copy, modify, merge, publish, distribute, sublicense,
+	and/or sell copies of the Software, and to permit persons to whom the Software
+	is furnished to do so, subject to the following conditions:
+
+	The above copyright notice and this permission notice shall be included
+	in all copies or substantial portions of the Software.
+
+	THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND,
+	EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES
+	OF MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT.
+	IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM,
+	DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE,
+	ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER
+	DEALINGS IN THE SOFTWARE.
+
+*/
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"net/http"
+	"time"
+)
+
+// DefaultRetryPolicy -
+// RETURNS THE POLICY USED WHEN NONE IS SET ON THE CLIENT OR CALL
+// ATTEMPTS ARE BOUND BY Settings.MaxRetries
+func DefaultRetryPolicy() *RetryPolicy {
+	return &RetryPolicy{
+		MaxAttempts:    int(Settings.MaxRetries) + 1,
+		InitialBackoff: 250 * time.Millisecond,
+		MaxBackoff:     5 * time.Second,
+		Multiplier:     2,
+		Jitter:         0.2,
+		MaxElapsed:     time.Minute,
+		Retryable:      IsRetryable,
+	}
+}
+
+// IsRetryable -
+// DEFAULT RETRYABLE-ERROR PREDICATE
+// AGENT API ERRORS ARE ONLY RETRIED ON TIMEOUTS, RATE LIMITS & SERVER ERRORS
+// ANY OTHER ERROR (NETWORK, DECODE) IS RETRIED
+func IsRetryable(err error) bool {
+	if err == nil {
+		return false
+	}
+	if errors.Is(err, ErrUpstreamUnreachable) {
+		return false
+	}
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) {
+		return true
+	}
+	if IsPlanLimit(err) {
+		return false
+	}
+	switch {
+	case apiErr.StatusCode == http.StatusRequestTimeout,
+		apiErr.StatusCode == http.StatusTooManyRequests,
+		apiErr.StatusCode >= 500:
+		return true
+	}
+	return false
+}
+
+// retryPolicy -
+// RESOLVES CALL POLICY, THEN CLIENT POLICY, THEN DEFAULT
+func (c *Client) retryPolicy(policy ...*RetryPolicy) *RetryPolicy {
+	for _, p := range policy {
+		if p != nil {
+			return p.withDefaults()
+		}
+	}
+	if c.Options != nil && c.Options.RetryPolicy != nil {
+		return c.Options.RetryPolicy.withDefaults()
+	}
+	return DefaultRetryPolicy()
+}
+
+// withDefaults -
+// COPY OF POLICY W/ ZERO VALUES FILLED FROM DefaultRetryPolicy
+func (p *RetryPolicy) withDefaults() *RetryPolicy {
+	def := DefaultRetryPolicy()
+	cp := *p
+	if cp.MaxAttempts <= 0 {
+		cp.MaxAttempts = def.MaxAttempts
+	}
+	if cp.InitialBackoff <= 0 {
+		cp.InitialBackoff = def.InitialBackoff
+	}
+	if cp.MaxBackoff <= 0 {
+		cp.MaxBackoff = def.MaxBackoff
+	}
+	if cp.Multiplier < 1 {
+		cp.Multiplier = def.Multiplier
+	}
+	if cp.Jitter < 0 || cp.Jitter > 1 {
+		cp.Jitter = def.Jitter
+	}
+	if cp.Retryable == nil {
+		cp.Retryable = def.Retryable
+	}
+	return &cp
+}
+
+// backoff -
+// WAIT BEFORE RETRY NUMBER attempt (1 BASED)
+func (p *RetryPolicy) backoff(attempt int) time.Duration {
+	wait := float64(p.InitialBackoff)
+	for i := 1; i < attempt; i++ {
+		wait *= p.Multiplier
+		if wait >= float64(p.MaxBackoff) {
+			wait = float64(p.MaxBackoff)
+			break
+		}
+	}
+	if p.Jitter > 0 {
+		wait *= 1 + p.Jitter*(2*rand.Float64()-1)
+	}
+	return time.Duration(wait)
+}
+
+// do -
+// RUN fn UNTIL IT SUCCEEDS, RETURNS A NON-RETRYABLE ERROR OR THE POLICY IS EXHAUSTED
+// STOPS W/ ctx.Err() ONCE CTX ENDS
+func (p *RetryPolicy) do(ctx context.Context, fn func() error) (err error) {
+	start := time.Now()
+	for attempt := 0; attempt < p.MaxAttempts; attempt++ {
+		if attempt > 0 {
+			wait := p.backoff(attempt)
+			if p.MaxElapsed > 0 && time.Since(start)+wait > p.MaxElapsed {
+				return
+			}
+			timer := time.NewTimer(wait)
+			select {
+			case <-ctx.Done():
+				timer.Stop()
+				return ctx.Err()
+			case <-timer.C:
+			}
+		}
+		if cerr := ctx.Err(); cerr != nil {
+			return cerr
+		}
+		err = fn()
+		if err == nil || !p.Retryable(err) {
+			return
+		}
+		if Settings.ShouldLog {
+			Logger.Printf("attempt %d/%d failed: %s\n", attempt+1, p.MaxAttempts, err)
+		}
+	}
+	return
+}
@@ -0,0 +1,125 @@
+package gongrok
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestIsRetryable(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"nil", nil, false},
+		{"network", errors.New("connection refused"), true},
+		{"upstream", fmt.Errorf("%w: localhost:8080", ErrUpstreamUnreachable), false},
+		{"timeout", &APIError{StatusCode: http.StatusRequestTimeout}, true},
+		{"rate limit", &APIError{StatusCode: http.StatusTooManyRequests}, true},
+		{"server error", &APIError{StatusCode: http.StatusBadGateway}, true},
+		{"bad request", &APIError{StatusCode: http.StatusBadRequest}, false},
+		{"not found", &APIError{StatusCode: http.StatusNotFound}, false},
+		{"plan limit", &APIError{StatusCode: http.StatusServiceUnavailable, Msg: "Your account is limited to 1 simultaneous ngrok client session"}, false},
+		{"wrapped", fmt.Errorf("create: %w", &APIError{StatusCode: http.StatusInternalServerError}), true},
+	} {
+		if got := IsRetryable(tc.err); got != tc.want {
+			t.Errorf("%s: IsRetryable = %t, want %t", tc.name, got, tc.want)
+		}
+	}
+}
+
+func TestRetryPolicyBackoff(t *testing.T) {
+	p := &RetryPolicy{InitialBackoff: 100 * time.Millisecond, MaxBackoff: time.Second, Multiplier: 2}
+	for attempt, want := range map[int]time.Duration{
+		1: 100 * time.Millisecond,
+		2: 200 * time.Millisecond,
+		3: 400 * time.Millisecond,
+		4: 800 * time.Millisecond,
+		5: time.Second,
+		9: time.Second,
+	} {
+		if got := p.backoff(attempt); got != want {
+			t.Errorf("backoff(%d) = %s, want %s", attempt, got, want)
+		}
+	}
+
+	p.Jitter = 0.5
+	for i := 0; i < 100; i++ {
+		if got := p.backoff(1); got < 50*time.Millisecond || got > 150*time.Millisecond {
+			t.Fatalf("backoff(1) w/ jitter 0.5 = %s, want 50ms - 150ms", got)
+		}
+	}
+}
+
+func TestRetryPolicyWithDefaults(t *testing.T) {
+	def := DefaultRetryPolicy()
+	p := (&RetryPolicy{MaxAttempts: 3, Multiplier: 0.5, Jitter: 2}).withDefaults()
+	if p.MaxAttempts != 3 {
+		t.Errorf("MaxAttempts = %d, want 3", p.MaxAttempts)
+	}
+	if p.InitialBackoff != def.InitialBackoff || p.MaxBackoff != def.MaxBackoff {
+		t.Errorf("backoff = %s - %s, want %s - %s", p.InitialBackoff, p.MaxBackoff, def.InitialBackoff, def.MaxBackoff)
+	}
+	if p.Multiplier != def.Multiplier || p.Jitter != def.Jitter {
+		t.Errorf("multiplier = %v, jitter = %v", p.Multiplier, p.Jitter)
+	}
+	if p.Retryable == nil {
+		t.Error("Retryable = nil")
+	}
+}
+
+func TestRetryPolicyDo(t *testing.T) {
+	fast := &RetryPolicy{MaxAttempts: 4, InitialBackoff: time.Millisecond, MaxBackoff: time.Millisecond, Multiplier: 1, Retryable: IsRetryable}
+	for _, tc := range []struct {
+		name     string
+		errs     []error
+		want     error
+		attempts int
+	}{
+		{"first try", []error{nil}, nil, 1},
+		{"retried", []error{errors.New("reset"), errors.New("reset"), nil}, nil, 3},
+		{"exhausted", []error{errors.New("a"), errors.New("b"), errors.New("c"), errors.New("d")}, errors.New("d"), 4},
+		{"not retryable", []error{&APIError{StatusCode: http.StatusBadRequest}}, &APIError{StatusCode: http.StatusBadRequest}, 1},
+	} {
+		attempts := 0
+		err := fast.do(context.Background(), func() error {
+			err := tc.errs[attempts]
+			attempts++
+			return err
+		})
+		if fmt.Sprint(err) != fmt.Sprint(tc.want) {
+			t.Errorf("%s: err = %v, want %v", tc.name, err, tc.want)
+		}
+		if attempts != tc.attempts {
+			t.Errorf("%s: attempts = %d, want %d", tc.name, attempts, tc.attempts)
+		}
+	}
+}
+
+func TestRetryPolicyDoStops(t *testing.T) {
+	slow := &RetryPolicy{MaxAttempts: 10, InitialBackoff: time.Hour, MaxBackoff: time.Hour, Multiplier: 1, Retryable: IsRetryable}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	attempts := 0
+	err := slow.do(ctx, func() error {
+		attempts++
+		return errors.New("reset")
+	})
+	if err != context.DeadlineExceeded || attempts != 1 {
+		t.Errorf("canceled: err = %v, attempts = %d", err, attempts)
+	}
+
+	slow.MaxElapsed = time.Minute
+	attempts = 0
+	err = slow.do(context.Background(), func() error {
+		attempts++
+		return errors.New("reset")
+	})
+	if err == nil || attempts != 1 {
+		t.Errorf("max elapsed: err = %v, attempts = %d", err, attempts)
+	}
+}
@@ -0,0 +1,89 @@
+package gongrok
+
+/*
+	Copyright 2021 revzim.
+
+	Permission is hereby granted, free of charge, to any person obtaining a
+	copy of this software and associated documentation files (the "Software"),
+	to deal in the Software without restriction, including without limitation
+	the rights to use, copy, modify, merge, publish, distribute, sublicense,
+	and/or sell copies of the Software, and to permit persons to whom the Software
+	is furnished to do so, subject to the following conditions:
+
+	The above copyright notice and this permission notice shall be included
+	in all copies or substantial portions of the Software.
+
+	THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND,
+	EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES
+	OF MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT.
+	IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM,
+	DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE,
+	ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER
+	DEALINGS IN THE SOFTWARE.
+
+*/
+import (
+	"context"
+	"net"
+	"net/http"
+	"time"
+)
+
+// ServeHandler -
+// SERVE HANDLER ON A LOOPBACK LISTENER & EXPOSE IT THROUGH A NEW HTTP TUNNEL
+// RETURNS THE PUBLIC URL, TUNNEL & SERVER ARE TORN DOWN ONCE CTX ENDS
+// A TUNNEL THE AGENT FAILED TO CLOSE STAYS ON THE CLIENT FOR DisconnectAll
+func (c *Client) ServeHandler(ctx context.Context, name string, handler http.Handler) (string, error) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return "", err
+	}
+	srv := &http.Server{Handler: handler}
+	go func() {
+		if err := srv.Serve(ln); err != nil && err != http.ErrServerClosed {
+			if Settings.ShouldLog {
+				Logger.Printf("serve handler %s err: %s\n", name, err)
+			}
+		}
+	}()
+
+	t := &Tunnel{
+		Proto:        HTTP,
+		Name:         name,
+		LocalAddress: ln.Addr().String(),
+	}
+	if err := c.AddTunnel(t); err != nil {
+		srv.Close()
+		return "", err
+	}
+	if err := c.InitTunnel(t); err != nil {
+		c.RemoveTunnel(name)
+		srv.Close()
+		return "", err
+	}
+
+	c.mu.RLock()
+	publicURL := t.RemoteAddress
+	c.mu.RUnlock()
+
+	go func() {
+		<-ctx.Done()
+		if Settings.ShouldLog {
+			Logger.Printf("Tearing down handler tunnel %s\n", name)
+		}
+		// ONLY FORGET THE TUNNEL ONCE THE AGENT NO LONGER HAS IT
+		if err := c.CloseTunnel(t); err != nil && !IsNotFound(err) {
+			if Settings.ShouldLog {
+				Logger.Printf("close handler tunnel %s err: %s\n", name, err)
+			}
+		} else {
+			c.RemoveTunnel(name)
+		}
+
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		srv.Shutdown(shutdownCtx)
+	}()
+
+	return publicURL, nil
+}
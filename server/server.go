@@ -0,0 +1,414 @@
+package server
+
+/*
+	Copyright 2021 revzim.
+
+	Permission is hereby granted, free of charge, to any person obtaining a
+	copy of this software and associated documentation files (the "Software"),
+	to deal in the Software without restriction, including without limitation
+	the rights to use, copy, modify, merge, publish, distribute, sublicense,
+	and/or sell copies of the Software, and to permit persons to whom the Software
+	is furnished to do so, subject to the following conditions:
+
+	The above copyright notice and this permission notice shall be included
+	in all copies or substantial portions of the Software.
+
+	THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND,
+	EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES
+	OF MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT.
+	IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM,
+	DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE,
+	ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER
+	DEALINGS IN THE SOFTWARE.
+
+*/
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/revzim/gongrok"
+)
+
+type (
+	// Server -
+	// REST MANAGEMENT API FOR gongrok CLIENTS & TUNNELS
+	// MOUNT W/ http.Handle("/api/", http.StripPrefix("/api", srv))
+	// OR e.Any("/api/*", echo.WrapHandler(http.StripPrefix("/api", srv)))
+	Server struct {
+		Defaults gongrok.Options  // OPTIONS MERGED INTO EVERY NEW CLIENT
+		Manager  *gongrok.Manager // CLIENTS SERVED, SHARE IT TO EXPOSE CLIENTS CREATED ELSEWHERE
+	}
+
+	// newClientRequest -
+	// BODY FOR POST /clients
+	newClientRequest struct {
+		Options gongrok.Options   `json:"options"` // ONLY region, subdomain & authtoken ARE USED, REST COMES FROM Server.Defaults
+		Tunnels []*gongrok.Tunnel `json:"tunnels"` // TUNNELS TO CREATE ONCE AGENT IS READY
+	}
+
+	// clientView -
+	// CLIENT AS RETURNED BY THE API, AUTHTOKEN & TUNNEL AUTH REDACTED
+	clientView struct {
+		ID             string            `json:"id"`             // CLIENT ID
+		Options        gongrok.Options   `json:"options"`        // AGENT OPTIONS
+		Tunnels        []*gongrok.Tunnel `json:"tunnels"`        // COPIES OF CLIENT TUNNELS
+		NGROKLocalAddr string            `json:"ngroklocaladdr"` // AGENT API ADDR
+	}
+
+	// errorBody -
+	// JSON BODY FOR EVERY ERROR RESPONSE
+	errorBody struct {
+		Error   string   `json:"error"`             // WHAT WENT WRONG
+		Details []string `json:"details,omitempty"` // PER FIELD OR PER TUNNEL PROBLEMS
+	}
+)
+
+const (
+	redacted = "REDACTED" // REPLACES SECRETS IN RESPONSES
+)
+
+var (
+	errNotFound = errors.New("not found")
+)
+
+// New -
+// INITS & RETURNS NEW SERVER W/ ITS OWN UNCAPPED MANAGER
+func New(defaults gongrok.Options) *Server {
+	return &Server{Defaults: defaults, Manager: gongrok.NewManager(0)}
+}
+
+// Close -
+// DISCONNECT & CLOSE EVERY CLIENT
+func (s *Server) Close() error {
+	return s.Manager.Close()
+}
+
+// ServeHTTP -
+// ROUTES
+//
+//	GET    /clients
+//	POST   /clients
+//	GET    /clients/:id
+//	DELETE /clients/:id
+//	POST   /clients/:id/tunnels
+//	DELETE /clients/:id/tunnels/:name
+//	GET    /clients/:id/tunnels/:name/metrics
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+	handlers := s.route(w, r, parts)
+	if handlers == nil {
+		writeError(w, http.StatusNotFound, errNotFound)
+		return
+	}
+	handle, ok := handlers[r.Method]
+	if !ok {
+		allowed := make([]string, 0, len(handlers))
+		for method := range handlers {
+			allowed = append(allowed, method)
+		}
+		sort.Strings(allowed)
+		w.Header().Set("Allow", strings.Join(allowed, ", "))
+		writeError(w, http.StatusMethodNotAllowed, fmt.Errorf("method %s not allowed on %s", r.Method, r.URL.Path))
+		return
+	}
+	handle()
+}
+
+// route -
+// HANDLERS BY METHOD FOR THE ROUTE MATCHING PATH PARTS, NIL IF NO ROUTE MATCHES
+func (s *Server) route(w http.ResponseWriter, r *http.Request, parts []string) map[string]func() {
+	if parts[0] != "clients" {
+		return nil
+	}
+	switch {
+	case len(parts) == 1:
+		return map[string]func(){
+			http.MethodGet:  func() { s.listClients(w, r) },
+			http.MethodPost: func() { s.createClient(w, r) },
+		}
+	case len(parts) == 2:
+		return map[string]func(){
+			http.MethodGet:    func() { s.getClient(w, r, parts[1]) },
+			http.MethodDelete: func() { s.deleteClient(w, r, parts[1]) },
+		}
+	case len(parts) == 3 && parts[2] == "tunnels":
+		return map[string]func(){
+			http.MethodPost: func() { s.addTunnel(w, r, parts[1]) },
+		}
+	case len(parts) == 4 && parts[2] == "tunnels":
+		return map[string]func(){
+			http.MethodDelete: func() { s.removeTunnel(w, r, parts[1], parts[3]) },
+		}
+	case len(parts) == 5 && parts[2] == "tunnels" && parts[4] == "metrics":
+		return map[string]func(){
+			http.MethodGet: func() { s.tunnelMetrics(w, r, parts[1], parts[3]) },
+		}
+	}
+	return nil
+}
+
+// listClients -
+// GET /clients
+func (s *Server) listClients(w http.ResponseWriter, r *http.Request) {
+	clients := s.Manager.Clients()
+	views := make([]clientView, 0, len(clients))
+	for _, c := range clients {
+		views = append(views, s.view(c))
+	}
+	writeJSON(w, http.StatusOK, views)
+}
+
+// createClient -
+// POST /clients
+func (s *Server) createClient(w http.ResponseWriter, r *http.Request) {
+	req := &newClientRequest{}
+	if err := json.NewDecoder(r.Body).Decode(req); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	opt := s.merge(req.Options)
+
+	// VALIDATE BEFORE SPAWNING AN AGENT
+	probe := &gongrok.Client{}
+	for _, t := range req.Tunnels {
+		clearState(t)
+		if err := probe.AddTunnel(t); err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+	}
+
+	c, err := s.Manager.NewClient(opt)
+	if err != nil {
+		writeError(w, statusFor(err), err)
+		return
+	}
+	for _, t := range req.Tunnels {
+		c.AddTunnel(t)
+	}
+	if len(req.Tunnels) > 0 {
+		if err := c.ConnectAll(); err != nil {
+			s.Manager.CloseClient(c.ID)
+			writeError(w, statusFor(err), err)
+			return
+		}
+	}
+	writeJSON(w, http.StatusCreated, s.view(c))
+}
+
+// getClient -
+// GET /clients/:id
+func (s *Server) getClient(w http.ResponseWriter, r *http.Request, id string) {
+	c, ok := s.client(id)
+	if !ok {
+		writeError(w, http.StatusNotFound, fmt.Errorf("no client %s", id))
+		return
+	}
+	writeJSON(w, http.StatusOK, s.view(c))
+}
+
+// deleteClient -
+// DELETE /clients/:id
+func (s *Server) deleteClient(w http.ResponseWriter, r *http.Request, id string) {
+	if _, ok := s.Manager.Client(id); !ok {
+		writeError(w, http.StatusNotFound, fmt.Errorf("no client %s", id))
+		return
+	}
+	if err := s.Manager.CloseClient(id); err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// addTunnel -
+// POST /clients/:id/tunnels
+func (s *Server) addTunnel(w http.ResponseWriter, r *http.Request, id string) {
+	c, ok := s.client(id)
+	if !ok {
+		writeError(w, http.StatusNotFound, fmt.Errorf("no client %s", id))
+		return
+	}
+	t := &gongrok.Tunnel{}
+	if err := json.NewDecoder(r.Body).Decode(t); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	clearState(t)
+
+	if c.FindTunnel(t.Name) != nil {
+		writeError(w, http.StatusConflict, fmt.Errorf("tunnel %s already exists on client %s", t.Name, id))
+		return
+	}
+	if err := c.AddTunnel(t); err != nil {
+		writeError(w, statusFor(err), err)
+		return
+	}
+	if err := c.InitTunnel(t); err != nil {
+		c.RemoveTunnel(t.Name)
+		writeError(w, statusFor(err), err)
+		return
+	}
+	created := c.FindTunnel(t.Name)
+	if created == nil {
+		writeError(w, http.StatusGone, fmt.Errorf("tunnel %s closed before it could be returned", t.Name))
+		return
+	}
+	writeJSON(w, http.StatusCreated, redact(created))
+}
+
+// removeTunnel -
+// DELETE /clients/:id/tunnels/:name
+func (s *Server) removeTunnel(w http.ResponseWriter, r *http.Request, id, name string) {
+	c, ok := s.client(id)
+	if !ok {
+		writeError(w, http.StatusNotFound, fmt.Errorf("no client %s", id))
+		return
+	}
+	if c.FindTunnel(name) == nil {
+		writeError(w, http.StatusNotFound, fmt.Errorf("no tunnel %s on client %s", name, id))
+		return
+	}
+	if err := c.DisconnectTunnel(name); err != nil && !gongrok.IsNotFound(err) {
+		writeError(w, statusFor(err), err)
+		return
+	}
+	c.RemoveTunnel(name)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// tunnelMetrics -
+// GET /clients/:id/tunnels/:name/metrics
+func (s *Server) tunnelMetrics(w http.ResponseWriter, r *http.Request, id, name string) {
+	c, ok := s.client(id)
+	if !ok {
+		writeError(w, http.StatusNotFound, fmt.Errorf("no client %s", id))
+		return
+	}
+	if c.FindTunnel(name) == nil {
+		writeError(w, http.StatusNotFound, fmt.Errorf("no tunnel %s on client %s", name, id))
+		return
+	}
+	metrics, err := c.TunnelMetrics(name)
+	if err != nil {
+		writeError(w, statusFor(err), err)
+		return
+	}
+	writeJSON(w, http.StatusOK, metrics)
+}
+
+// client -
+// LOOKUP CLIENT BY ID
+func (s *Server) client(id string) (*gongrok.Client, bool) {
+	return s.Manager.Client(id)
+}
+
+// view -
+// REDACTED CLIENT W/ A SNAPSHOT OF ITS TUNNELS, SEE gongrok.Client.Snapshot
+func (s *Server) view(c *gongrok.Client) clientView {
+	tunnels := c.Snapshot()
+	v := clientView{ID: c.ID, NGROKLocalAddr: c.NGROKLocalAddr, Tunnels: make([]*gongrok.Tunnel, 0, len(tunnels))}
+	if c.Options != nil {
+		v.Options = *c.Options
+	}
+	if v.Options.AuthToken != "" {
+		v.Options.AuthToken = redacted
+	}
+	for _, t := range tunnels {
+		v.Tunnels = append(v.Tunnels, redact(t))
+	}
+	return v
+}
+
+// clearState -
+// DROP SERVER OWNED TUNNEL STATE A CALLER MAY HAVE SENT, E.G. "iscreated": true
+func clearState(t *gongrok.Tunnel) {
+	t.RemoteAddress = ""
+	t.IsCreated = false
+	t.Healthy = false
+	t.HealthErr = ""
+	t.LastCheck = time.Time{}
+}
+
+// redact -
+// COPY OF TUNNEL SNAPSHOT W/ AUTH REDACTED
+func redact(t *gongrok.Tunnel) *gongrok.Tunnel {
+	cp := *t
+	if cp.Auth != "" {
+		cp.Auth = redacted
+	}
+	return &cp
+}
+
+// merge -
+// NEW CLIENT OPTIONS FROM Server.Defaults
+// ONLY region, subdomain & authtoken ARE TAKEN FROM THE REQUEST, NEVER BINARY OR CONFIG PATHS
+func (s *Server) merge(opt gongrok.Options) gongrok.Options {
+	merged := s.Defaults
+	if opt.Region != "" {
+		merged.Region = opt.Region
+	}
+	if opt.SubDomain != "" {
+		merged.SubDomain = opt.SubDomain
+	}
+	if opt.AuthToken != "" {
+		merged.AuthToken = opt.AuthToken
+	}
+	return merged
+}
+
+// statusFor -
+// MAP gongrok ERRORS TO HTTP STATUS CODES
+func statusFor(err error) int {
+	var verr *gongrok.ValidationError
+	var apiErr *gongrok.APIError
+	var merr *gongrok.MultiError
+	switch {
+	case errors.As(err, &verr):
+		return http.StatusBadRequest
+	case gongrok.IsConflict(err):
+		return http.StatusConflict
+	case gongrok.IsPlanLimit(err), errors.Is(err, gongrok.ErrSessionLimit), errors.Is(err, gongrok.ErrTooManyAgents):
+		return http.StatusTooManyRequests
+	case errors.Is(err, gongrok.ErrUpstreamUnreachable):
+		return http.StatusBadGateway
+	case errors.As(err, &apiErr):
+		if apiErr.StatusCode >= 400 && apiErr.StatusCode < 500 {
+			return apiErr.StatusCode
+		}
+		return http.StatusBadGateway
+	case errors.As(err, &merr):
+		return http.StatusBadGateway
+	}
+	return http.StatusInternalServerError
+}
+
+// writeJSON -
+// WRITE V AS JSON W/ STATUS
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+// writeError -
+// WRITE ERROR BODY W/ STATUS
+func writeError(w http.ResponseWriter, status int, err error) {
+	body := errorBody{Error: err.Error()}
+	var verr *gongrok.ValidationError
+	var merr *gongrok.MultiError
+	switch {
+	case errors.As(err, &verr):
+		body.Details = verr.Problems
+	case errors.As(err, &merr):
+		for _, name := range merr.Failed() {
+			body.Details = append(body.Details, fmt.Sprintf("%s: %s", name, merr.Results[name]))
+		}
+	}
+	writeJSON(w, status, body)
+}
@@ -0,0 +1,148 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/revzim/gongrok"
+)
+
+// fakeAgent -
+// AGENT API SERVING GET, POST & DELETE /api/tunnels
+type fakeAgent struct {
+	posts []gongrok.Map
+	mu    sync.Mutex
+}
+
+func (a *fakeAgent) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	switch {
+	case r.Method == http.MethodGet && r.URL.Path == "/api/tunnels":
+		w.Write([]byte(`{"tunnels": []}`))
+	case r.Method == http.MethodPost && r.URL.Path == "/api/tunnels":
+		body := gongrok.Map{}
+		json.NewDecoder(r.Body).Decode(&body)
+		a.posts = append(a.posts, body)
+		json.NewEncoder(w).Encode(gongrok.Map{"name": body["name"], "public_url": "https://web.ngrok.io"})
+	case r.Method == http.MethodDelete && strings.HasPrefix(r.URL.Path, "/api/tunnels/"):
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+// testServer -
+// SERVER MANAGING ONE CLIENT ATTACHED TO AGENT
+func testServer(t *testing.T, agent http.Handler) (*httptest.Server, *gongrok.Client) {
+	agentSrv := httptest.NewServer(agent)
+	t.Cleanup(agentSrv.Close)
+	c, err := gongrok.Attach(context.Background(), agentSrv.URL, gongrok.Options{AuthToken: "secret-token", HTTPClient: agentSrv.Client()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := New(gongrok.Options{})
+	if err := s.Manager.Add(c); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { s.Close() })
+	srv := httptest.NewServer(s)
+	t.Cleanup(srv.Close)
+	return srv, c
+}
+
+func do(t *testing.T, method, url, body string) *http.Response {
+	req, err := http.NewRequest(method, url, strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { res.Body.Close() })
+	return res
+}
+
+func TestRoutes(t *testing.T) {
+	srv, c := testServer(t, &fakeAgent{})
+	for _, tc := range []struct {
+		method, path string
+		status       int
+		allow        string
+	}{
+		{http.MethodGet, "/clients", http.StatusOK, ""},
+		{http.MethodGet, "/clients/" + c.ID, http.StatusOK, ""},
+		{http.MethodGet, "/clients/missing", http.StatusNotFound, ""},
+		{http.MethodGet, "/clients/" + c.ID + "/bogus", http.StatusNotFound, ""},
+		{http.MethodGet, "/nope", http.StatusNotFound, ""},
+		{http.MethodPut, "/clients", http.StatusMethodNotAllowed, "GET, POST"},
+		{http.MethodPost, "/clients/" + c.ID, http.StatusMethodNotAllowed, "DELETE, GET"},
+		{http.MethodGet, "/clients/" + c.ID + "/tunnels", http.StatusMethodNotAllowed, "POST"},
+		{http.MethodGet, "/clients/" + c.ID + "/tunnels/web", http.StatusMethodNotAllowed, "DELETE"},
+		{http.MethodDelete, "/clients/" + c.ID + "/tunnels/web", http.StatusNotFound, ""},
+	} {
+		res := do(t, tc.method, srv.URL+tc.path, "")
+		if res.StatusCode != tc.status {
+			t.Errorf("%s %s = %d, want %d", tc.method, tc.path, res.StatusCode, tc.status)
+		}
+		if got := res.Header.Get("Allow"); got != tc.allow {
+			t.Errorf("%s %s Allow = %q, want %q", tc.method, tc.path, got, tc.allow)
+		}
+	}
+}
+
+func TestAddTunnelRedacts(t *testing.T) {
+	agent := &fakeAgent{}
+	srv, c := testServer(t, agent)
+	url := srv.URL + "/clients/" + c.ID + "/tunnels"
+
+	res := do(t, http.MethodPost, url, `{"name": "web", "proto": "http", "localaddr": "8080", "auth": "user:hunter2", "iscreated": true, "remoteaddr": "https://evil.io"}`)
+	if res.StatusCode != http.StatusCreated {
+		t.Fatalf("POST %s = %d, want 201", url, res.StatusCode)
+	}
+	created := &gongrok.Tunnel{}
+	if err := json.NewDecoder(res.Body).Decode(created); err != nil {
+		t.Fatal(err)
+	}
+	if created.Auth != redacted {
+		t.Errorf("created auth = %q, want %q", created.Auth, redacted)
+	}
+	if !created.IsCreated || created.RemoteAddress != "https://web.ngrok.io" {
+		t.Errorf("created = %+v", created)
+	}
+	if len(agent.posts) != 1 || agent.posts[0]["auth"] != "user:hunter2" {
+		t.Errorf("agent posts = %v", agent.posts)
+	}
+	if got := c.FindTunnel("web"); got == nil || got.Auth != "user:hunter2" {
+		t.Errorf("client tunnel = %+v", got)
+	}
+
+	res = do(t, http.MethodPost, url, `{"name": "web", "localaddr": "9090"}`)
+	if res.StatusCode != http.StatusConflict {
+		t.Errorf("duplicate POST %s = %d, want 409", url, res.StatusCode)
+	}
+
+	res = do(t, http.MethodGet, srv.URL+"/clients/"+c.ID, "")
+	body, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(body), "hunter2") || strings.Contains(string(body), "secret-token") {
+		t.Errorf("GET client leaked secrets: %s", body)
+	}
+
+	res = do(t, http.MethodDelete, url+"/web", "")
+	if res.StatusCode != http.StatusNoContent {
+		t.Errorf("DELETE %s/web = %d, want 204", url, res.StatusCode)
+	}
+	if c.FindTunnel("web") != nil {
+		t.Error("tunnel not removed")
+	}
+}
@@ -0,0 +1,162 @@
+package gongrok
+
+/*
+	Copyright 2021 revzim.
+
+	Permission is hereby granted, free of charge, to any person obtaining a
+	copy of this software and associated documentation files (the "Software"),
+	to deal in the Software without restriction, including without limitation
+	the rights to use, copy, modify, merge, publish, distribute, sublicense,
+	and/or sell copies of the Software, and to permit persons to whom the Software
+	is furnished to do so, subject to the following conditions:
+
+	The above copyright notice and this permission notice shall be included
+	in all copies or substantial portions of the Software.
+
+	THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND,
+	EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES
+	OF MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT.
+	IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM,
+	DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE,
+	ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER
+	DEALINGS IN THE SOFTWARE.
+
+*/
+import (
+	"strings"
+	"sync"
+	"time"
+)
+
+// SESSION LIMIT POLICIES, SEE Options.SessionLimit
+const (
+	SessionLimitFail  SessionPolicy = "fail"  // RETURN ErrSessionLimit FROM Start (DEFAULT)
+	SessionLimitQueue SessionPolicy = "queue" // WAIT FOR ANOTHER CLIENT OF THE SAME ACCOUNT IN THIS PROCESS TO EXIT & RETRY
+	SessionLimitReuse SessionPolicy = "reuse" // SHARE AN AGENT OF THE SAME ACCOUNT ALREADY RUNNING IN THIS PROCESS
+)
+
+var (
+	agentsMu    sync.Mutex
+	agents      []*Client                        // AGENTS STARTED BY THIS PROCESS, OLDEST FIRST
+	agentExited = make(map[string]chan struct{}) // ACCOUNT KEY -> CLOSED ONCE AN AGENT OF THAT ACCOUNT EXITS
+)
+
+// admit -
+// APPLY Options.SessionLimit AFTER Start HIT ErrSessionLimit
+// NIL ERROR MEANS RETRY (QUEUE) OR THE CLIENT NOW SHARES AN AGENT (REUSE)
+// ONLY AGENTS W/ THE SAME AUTHTOKEN, REGION & CONFIG ARE WAITED ON OR SHARED
+// QUEUED CLIENTS GIVE UP W/ ErrSessionLimit AT DEADLINE
+func (c *Client) admit(deadline time.Time) (retry bool, err error) {
+	key := accountKey(c.Options)
+	switch c.Options.SessionLimit {
+	case SessionLimitQueue:
+		agentsMu.Lock()
+		if accountAgent(key) == nil {
+			agentsMu.Unlock()
+			return false, ErrSessionLimit
+		}
+		exited, ok := agentExited[key]
+		if !ok {
+			exited = make(chan struct{})
+			agentExited[key] = exited
+		}
+		agentsMu.Unlock()
+		if Settings.ShouldLog {
+			Logger.Println("session limit reached, waiting for an agent to exit")
+		}
+		timer := time.NewTimer(time.Until(deadline))
+		defer timer.Stop()
+		select {
+		case <-exited:
+			return true, nil
+		case <-timer.C:
+			return false, ErrSessionLimit
+		}
+	case SessionLimitReuse:
+		agentsMu.Lock()
+		defer agentsMu.Unlock()
+		host := accountAgent(key)
+		if host == nil {
+			return false, ErrSessionLimit
+		}
+		c.share(host)
+		return false, nil
+	}
+	return false, ErrSessionLimit
+}
+
+// accountKey -
+// AGENTS W/ EQUAL KEYS RUN UNDER THE SAME NGROK ACCOUNT & SETTINGS
+func accountKey(o *Options) string {
+	return strings.Join([]string{o.AuthToken, o.Region, o.CFGPath}, "\x00")
+}
+
+// accountAgent -
+// OLDEST RUNNING AGENT FOR ACCOUNT KEY, NIL IF NONE
+// CALLER MUST HOLD agentsMu
+func accountAgent(key string) *Client {
+	for _, a := range agents {
+		if accountKey(a.Options) == key {
+			return a
+		}
+	}
+	return nil
+}
+
+// share -
+// BIND CLIENT TO host's AGENT INSTEAD OF RUNNING ITS OWN
+func (c *Client) share(host *Client) {
+	if Settings.ShouldLog {
+		Logger.Printf("session limit reached, sharing agent %s w/ client %s\n", host.NGROKLocalAddr, host.ID)
+	}
+	c.host = host
+	c.NGROKLocalAddr = host.NGROKLocalAddr
+	c.done = host.done
+}
+
+// trackAgent -
+// RECORD c AS A RUNNING AGENT AVAILABLE FOR REUSE
+func trackAgent(c *Client) {
+	agentsMu.Lock()
+	defer agentsMu.Unlock()
+	agents = append(agents, c)
+}
+
+// untrackAgent -
+// DROP c ONCE ITS AGENT EXITED & WAKE CLIENTS QUEUED ON ITS ACCOUNT
+func untrackAgent(c *Client) {
+	agentsMu.Lock()
+	defer agentsMu.Unlock()
+	for i := range agents {
+		if agents[i] == c {
+			agents = append(agents[:i], agents[i+1:]...)
+			key := accountKey(c.Options)
+			if exited, ok := agentExited[key]; ok {
+				close(exited)
+				delete(agentExited, key)
+			}
+			return
+		}
+	}
+}
+
+// closeShared -
+// CLOSE TUNNELS THIS CLIENT CREATED ON A SHARED AGENT
+func (c *Client) closeShared() error {
+	var merr *MultiError
+	for _, t := range c.tunnels() {
+		if !c.isCreated(t) {
+			continue
+		}
+		if err := c.CloseTunnel(t); err != nil && !IsNotFound(err) {
+			if merr == nil {
+				merr = &MultiError{Results: make(map[string]error)}
+			}
+			merr.Results[t.Name] = err
+		}
+	}
+	if merr != nil {
+		return merr
+	}
+	return nil
+}
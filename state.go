@@ -0,0 +1,162 @@
+package gongrok
+
+/*
+	Copyright 2021 revzim.
+
+	Permission is hereby granted, free of charge, to any person obtaining a
+	copy of this software and associated documentation files (the "Software"),
+	to deal in the Software without restriction, including without limitation
+	the rights to use, copy, modify, merge, publish, distribute, sublicense,
+	and/or sell copies of the Software, and to permit persons to whom the Software
+	is furnished to do so, subject to the following conditions:
+
+	The above copyright notice and this permission notice shall be included
+	in all copies or substantial portions of the Software.
+
+	THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND,
+	EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES
+	OF MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT.
+	IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM,
+	DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE,
+	ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER
+	DEALINGS IN THE SOFTWARE.
+
+*/
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+const (
+	stateVersion = WireVersion // CURRENT STATE FILE FORMAT VERSION
+)
+
+// SaveState -
+// ATOMICALLY WRITE CLIENT OPTIONS & TUNNELS TO PATH
+func (c *Client) SaveState(path string) error {
+	state := clientState{
+		Version: stateVersion,
+		SavedAt: time.Now(),
+		ID:      c.ID,
+		Tunnels: c.Snapshot(),
+	}
+	if c.Options != nil {
+		state.Options = *c.Options
+	}
+	data, err := json.MarshalIndent(state, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := writeFileAtomic(path, data, 0600); err != nil {
+		return err
+	}
+	if Settings.ShouldLog {
+		Logger.Printf("Saved client %s state to %s\n", c.ID, path)
+	}
+	return nil
+}
+
+// RestoreState -
+// START A NEW AGENT FROM STATE AT PATH & RE-CREATE ITS TUNNELS
+// RESERVED SUBDOMAINS, HOSTNAMES & TCP ADDRESSES ARE REUSED
+// RETURNS THE CLIENT W/ *MultiError IF SOME TUNNELS FAILED
+// ONCE CTX ENDS, PREFLIGHTS & RETRIES STOP, THE NEW AGENT IS CLOSED & ctx.Err() IS RETURNED
+func RestoreState(ctx context.Context, path string) (*Client, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	state := clientState{}
+	if err := json.Unmarshal(data, &state); err != nil {
+		return nil, err
+	}
+	if state.Version > stateVersion {
+		return nil, fmt.Errorf("state %s version %d is newer than supported %d", path, state.Version, stateVersion)
+	}
+
+	c, err := NewClient(state.Options)
+	if err != nil {
+		return nil, err
+	}
+	if state.ID != "" {
+		c.ID = state.ID
+	}
+	started := make(chan error, 1)
+	go func() {
+		started <- c.Start()
+	}()
+	select {
+	case err := <-started:
+		if err != nil {
+			return nil, err
+		}
+	case <-ctx.Done():
+		// Start CANNOT BE INTERRUPTED, CLOSE THE AGENT IF IT STILL COMES UP
+		go func() {
+			if err := <-started; err == nil {
+				c.Close()
+			}
+		}()
+		return nil, ctx.Err()
+	}
+
+	for _, t := range state.Tunnels {
+		t.IsCreated = false
+		t.RemoteAddress = ""
+		t.Healthy = false
+		if err := c.AddTunnel(t); err != nil {
+			c.Close()
+			return nil, err
+		}
+	}
+	if len(state.Tunnels) < 1 {
+		return c, nil
+	}
+	err = c.connectAll(ctx)
+	if ctx.Err() != nil {
+		c.Close()
+		return nil, ctx.Err()
+	}
+	if err != nil {
+		return c, err
+	}
+	return c, nil
+}
+
+// writeFileAtomic -
+// WRITE TO TEMP FILE IN SAME DIR & RENAME OVER PATH
+func writeFileAtomic(path string, data []byte, perm os.FileMode) error {
+	dir := filepath.Dir(path)
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return err
+	}
+	f, err := ioutil.TempFile(dir, "."+filepath.Base(path)+".tmp")
+	if err != nil {
+		return err
+	}
+	tmp := f.Name()
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		os.Remove(tmp)
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		os.Remove(tmp)
+		return err
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	if err := os.Chmod(tmp, perm); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return os.Rename(tmp, path)
+}
@@ -24,24 +24,51 @@ package gongrok
 */
 import (
 	"bytes"
+	"context"
 	"encoding/json"
-	"errors"
 	"fmt"
-	"io/ioutil"
 	"net/http"
-	"time"
+	"net/url"
+	"strconv"
 )
 
 // InitTunnel -
-// ATTEMPTS TO CREATE NGROK TUNNEL
-func (c *Client) InitTunnel(t *Tunnel) (err error) {
-	for attempt := uint8(0); attempt <= Settings.MaxRetries; attempt++ {
-		err = func() error {
+// VALIDATES & ATTEMPTS TO CREATE NGROK TUNNEL
+// WAITS FOR UPSTREAM FIRST IF Tunnel.Preflight IS SET
+// OPTIONAL POLICY OVERRIDES THE CLIENT RETRY POLICY FOR THIS CALL
+func (c *Client) InitTunnel(t *Tunnel, policy ...*RetryPolicy) error {
+	return c.createTunnel(context.Background(), t, policy...)
+}
+
+// createTunnel -
+// VALIDATE & CREATE TUNNEL, PREFLIGHT & RETRIES STOP ONCE CTX ENDS
+func (c *Client) createTunnel(ctx context.Context, t *Tunnel, policy ...*RetryPolicy) error {
+	c.mu.RLock()
+	err := c.validateTunnel(t)
+	c.mu.RUnlock()
+	if err != nil {
+		return err
+	}
+	return c.initTunnel(ctx, t, policy...)
+}
+
+// initTunnel -
+// CREATE ALREADY VALIDATED TUNNEL
+func (c *Client) initTunnel(ctx context.Context, t *Tunnel, policy ...*RetryPolicy) error {
+	if t.Preflight != nil {
+		if err := t.Preflight.wait(ctx, t); err != nil {
+			if Settings.ShouldLog {
+				Logger.Printf("preflight tunnel %s err: %s\n", t.Name, err)
+			}
+			return err
+		}
+	}
+	return c.retryPolicy(policy...).do(ctx, func() error {
+		err := func() error {
 			if Settings.ShouldLog {
 				Logger.Println("Attempting to initialize tunnel...")
 				Logger.Printf(">>>\tName: %s | Addr: %s\n", t.Name, t.LocalAddress)
 			}
-			time.Sleep(1 * time.Second)
 
 			jsonData := t.getJSON()
 
@@ -58,7 +85,7 @@ func (c *Client) InitTunnel(t *Tunnel) (err error) {
 			}
 
 			// INIT RECORD
-			record, err := attemptInitTunnel(url, jsonValue)
+			record, err := attemptInitTunnel(c.httpClient(), url, jsonValue)
 
 			if err != nil {
 				if Settings.ShouldLog {
@@ -67,12 +94,23 @@ func (c *Client) InitTunnel(t *Tunnel) (err error) {
 				return err
 			}
 
+			c.mu.Lock()
 			t.RemoteAddress = record.PublicURL
 			t.IsCreated = true
+			t.Healthy = true
+			t.desired = true
+			previousURL := t.lastURL
+			t.lastURL = record.PublicURL
+			c.watchExpiry(t)
+			c.mu.Unlock()
 
 			if Settings.ShouldLog {
 				Logger.Println("Tunnel Created...")
-				Logger.Printf(">>> Name: %s | Public Addr: %s\n", t.Name, t.RemoteAddress)
+				Logger.Printf(">>> Name: %s | Public Addr: %s\n", t.Name, record.PublicURL)
+			}
+			c.emit(EventTunnelCreated, t, "")
+			if previousURL != "" && previousURL != record.PublicURL {
+				c.emit(EventTunnelURLChanged, t, previousURL)
 			}
 			return nil
 		}()
@@ -81,26 +119,22 @@ func (c *Client) InitTunnel(t *Tunnel) (err error) {
 				Logger.Println(err)
 			}
 		}
-		if err == nil {
-			break
-		}
-	}
-	return
+		return err
+	})
 }
 
 // attemptInitTunnel
 // NGROK REQUEST TO INIT TUNNEL
-func attemptInitTunnel(url string, jsonBytes []byte) (*ngrokTunnelRecord, error) {
+func attemptInitTunnel(client *http.Client, url string, jsonBytes []byte) (*ngrokTunnelRecord, error) {
 	record := &ngrokTunnelRecord{}
-	res, err := http.Post(url, "application/json", bytes.NewBuffer(jsonBytes))
+	res, err := client.Post(url, "application/json", bytes.NewBuffer(jsonBytes))
 	if err != nil {
 		return nil, err
 	}
 	defer res.Body.Close()
 
 	if res.StatusCode < 200 || res.StatusCode > 299 {
-		res, _ := ioutil.ReadAll(res.Body)
-		return nil, errors.New("error api: " + string(res))
+		return nil, newAPIError(res)
 	}
 
 	if err := json.NewDecoder(res.Body).Decode(&record); err != nil {
@@ -111,28 +145,44 @@ func attemptInitTunnel(url string, jsonBytes []byte) (*ngrokTunnelRecord, error)
 
 // CloseTunnel -
 // CLOSE NGROK TUNNEL
-func (c *Client) CloseTunnel(t *Tunnel) (err error) {
-	for attempt := uint8(0); attempt <= Settings.MaxRetries; attempt++ {
-		err = func() error {
+// DRAINS OPEN CONNECTIONS FIRST IF Tunnel.Drain IS SET
+// OPTIONAL POLICY OVERRIDES THE CLIENT RETRY POLICY FOR THIS CALL
+func (c *Client) CloseTunnel(t *Tunnel, policy ...*RetryPolicy) error {
+	c.mu.RLock()
+	drain := t.Drain != nil && t.IsCreated
+	remoteAddr := t.RemoteAddress
+	c.mu.RUnlock()
+	if drain {
+		t.Drain.wait(c, t)
+	}
+	return c.retryPolicy(policy...).do(context.Background(), func() error {
+		err := func() error {
 			if Settings.ShouldLog {
 				Logger.Println("Closing ngrok tunnel...")
-				Logger.Printf(">>> Addr: %s | Local Server Addr: %s", t.RemoteAddress, t.LocalAddress)
+				Logger.Printf(">>> Addr: %s | Local Server Addr: %s", remoteAddr, t.LocalAddress)
 			}
 
 			url := fmt.Sprintf("%s/%s", fmt.Sprintf(Settings.TunnelAPIAddr, c.NGROKLocalAddr), t.Name)
-			err := attemptCloseTunnel(url)
+			err := attemptCloseTunnel(c.httpClient(), url)
 			if err != nil {
 				if Settings.ShouldLog {
 					Logger.Printf("attemptCloseTunnel err: %s\n", err)
 				}
 				return err
 			}
+			c.mu.Lock()
+			stopExpiry(t)
+			closedURL := t.RemoteAddress
 			t.RemoteAddress = ""
 			t.IsCreated = false
+			t.Healthy = false
+			t.desired = false
+			c.mu.Unlock()
 			if Settings.ShouldLog {
 				Logger.Println("Successfully closed tunnel...")
 				Logger.Printf(">>> Closed tunnel name: %s\n", t.Name)
 			}
+			c.emit(EventTunnelClosed, t, closedURL)
 			return nil
 		}()
 		if c.LogAPI && err != nil {
@@ -140,16 +190,13 @@ func (c *Client) CloseTunnel(t *Tunnel) (err error) {
 				Logger.Println(err)
 			}
 		}
-		if err == nil {
-			break
-		}
-	}
-	return
+		return err
+	})
 }
 
 // attemptCloseTunnel -
 // ATTEMPT TO CLOSE TUNNEL W/ PROVIDED URL
-func attemptCloseTunnel(url string) error {
+func attemptCloseTunnel(client *http.Client, url string) error {
 	req, err := http.NewRequest("DELETE", url, nil)
 	if err != nil {
 		if Settings.ShouldLog {
@@ -157,7 +204,6 @@ func attemptCloseTunnel(url string) error {
 		}
 		return err
 	}
-	client := &http.Client{}
 	res, err := client.Do(req)
 	if err != nil {
 		if Settings.ShouldLog {
@@ -168,8 +214,90 @@ func attemptCloseTunnel(url string) error {
 	defer res.Body.Close()
 
 	if res.StatusCode < 200 || res.StatusCode > 299 {
-		res, _ := ioutil.ReadAll(res.Body)
-		return errors.New("error api: " + string(res))
+		return newAPIError(res)
 	}
 	return nil
 }
+
+// httpClient -
+// HTTP CLIENT USED FOR ALL AGENT API CALLS
+// Options.HTTPClient IF SET, OTHERWISE A CLIENT W/ Settings.APITimeout
+func (c *Client) httpClient() *http.Client {
+	if c.Options != nil && c.Options.HTTPClient != nil {
+		return c.Options.HTTPClient
+	}
+	return &http.Client{Timeout: Settings.APITimeout}
+}
+
+// ListTunnels -
+// FETCH ALL TUNNELS CURRENTLY RUNNING ON THE AGENT
+func (c *Client) ListTunnels() ([]*Tunnel, error) {
+	return c.listTunnels(context.Background())
+}
+
+// listTunnels -
+// FETCH ALL AGENT TUNNELS W/ CONTEXT
+func (c *Client) listTunnels(ctx context.Context) ([]*Tunnel, error) {
+	list := &ngrokTunnelList{}
+	url := fmt.Sprintf(Settings.TunnelAPIAddr, c.NGROKLocalAddr)
+	if err := attemptGetJSON(ctx, c.httpClient(), url, list); err != nil {
+		return nil, err
+	}
+	tunnels := make([]*Tunnel, 0, len(list.Tunnels))
+	for i := range list.Tunnels {
+		tunnels = append(tunnels, list.Tunnels[i].toTunnel())
+	}
+	return tunnels, nil
+}
+
+// TunnelMetrics -
+// FETCH CURRENT METRICS FOR TUNNEL NAME
+func (c *Client) TunnelMetrics(name string) (*Metrics, error) {
+	record := &ngrokTunnelRecord{}
+	url := fmt.Sprintf("%s/%s", fmt.Sprintf(Settings.TunnelAPIAddr, c.NGROKLocalAddr), name)
+	if err := attemptGetJSON(context.Background(), c.httpClient(), url, record); err != nil {
+		return nil, err
+	}
+	return &record.Metricts, nil
+}
+
+// Requests -
+// FETCH REQUESTS CAPTURED BY THE AGENT FOR INSPECTION
+// EMPTY NAME RETURNS REQUESTS FOR ALL TUNNELS, LIMIT < 1 USES AGENT DEFAULT
+func (c *Client) Requests(name string, limit int) ([]Map, error) {
+	query := url.Values{}
+	if name != "" {
+		query.Set("tunnel_name", name)
+	}
+	if limit > 0 {
+		query.Set("limit", strconv.Itoa(limit))
+	}
+	list := &ngrokRequestList{}
+	reqURL := fmt.Sprintf(Settings.RequestAPIAddr, c.NGROKLocalAddr)
+	if len(query) > 0 {
+		reqURL += "?" + query.Encode()
+	}
+	if err := attemptGetJSON(context.Background(), c.httpClient(), reqURL, list); err != nil {
+		return nil, err
+	}
+	return list.Requests, nil
+}
+
+// attemptGetJSON -
+// GET URL & DECODE JSON RESPONSE INTO v
+func attemptGetJSON(ctx context.Context, client *http.Client, url string, v interface{}) error {
+	req, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		return err
+	}
+	res, err := client.Do(req.WithContext(ctx))
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		return newAPIError(res)
+	}
+	return json.NewDecoder(res.Body).Decode(v)
+}
@@ -0,0 +1,154 @@
+package gongrok
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeAgent -
+// AGENT API SERVING POST & DELETE /api/tunnels, FAILS THE FIRST failures POSTS W/ status
+type fakeAgent struct {
+	failures int
+	status   int
+	posts    []Map
+	deletes  []string
+	mu       sync.Mutex
+}
+
+func (a *fakeAgent) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	switch {
+	case r.Method == http.MethodPost && r.URL.Path == "/api/tunnels":
+		body := Map{}
+		json.NewDecoder(r.Body).Decode(&body)
+		a.posts = append(a.posts, body)
+		if a.failures > 0 {
+			a.failures--
+			w.WriteHeader(a.status)
+			fmt.Fprintf(w, `{"error_code": 102, "status_code": %d, "msg": "failed"}`, a.status)
+			return
+		}
+		json.NewEncoder(w).Encode(Map{"name": body["name"], "public_url": "https://" + body["name"].(string) + ".ngrok.io"})
+	case r.Method == http.MethodDelete && strings.HasPrefix(r.URL.Path, "/api/tunnels/"):
+		name := strings.TrimPrefix(r.URL.Path, "/api/tunnels/")
+		a.deletes = append(a.deletes, name)
+		if name == "gone" {
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`{"error_code": 100, "status_code": 404, "msg": "tunnel not found"}`))
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+// testClient -
+// CLIENT BOUND TO AGENT W/ FAST RETRIES
+func testClient(t *testing.T, agent http.Handler) *Client {
+	srv := httptest.NewServer(agent)
+	t.Cleanup(srv.Close)
+	return &Client{
+		ID:             "test",
+		NGROKLocalAddr: strings.TrimPrefix(srv.URL, "http://"),
+		attached:       true,
+		Options: &Options{
+			HTTPClient:  srv.Client(),
+			RetryPolicy: &RetryPolicy{MaxAttempts: 3, InitialBackoff: time.Millisecond, MaxBackoff: time.Millisecond},
+		},
+	}
+}
+
+func TestInitTunnel(t *testing.T) {
+	agent := &fakeAgent{}
+	c := testClient(t, agent)
+	tn := &Tunnel{Name: "web", Proto: HTTP, LocalAddress: "localhost:8080", Auth: "user:pass"}
+	if err := c.AddTunnel(tn); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.InitTunnel(tn); err != nil {
+		t.Fatal(err)
+	}
+	got := c.FindTunnel("web")
+	if !got.IsCreated || !got.Healthy || got.RemoteAddress != "https://web.ngrok.io" {
+		t.Errorf("tunnel = %+v", got)
+	}
+	if len(agent.posts) != 1 {
+		t.Fatalf("posts = %d, want 1", len(agent.posts))
+	}
+	post := agent.posts[0]
+	if post["proto"] != "http" || post["addr"] != "localhost:8080" || post["auth"] != "user:pass" || post["bind_tls"] != true {
+		t.Errorf("post = %v", post)
+	}
+}
+
+func TestInitTunnelRetries(t *testing.T) {
+	agent := &fakeAgent{failures: 2, status: http.StatusBadGateway}
+	c := testClient(t, agent)
+	tn := &Tunnel{Name: "db", Proto: TCP, LocalAddress: "5432"}
+	if err := c.InitTunnel(tn); err != nil {
+		t.Fatal(err)
+	}
+	if len(agent.posts) != 3 {
+		t.Errorf("posts = %d, want 3", len(agent.posts))
+	}
+	if _, ok := agent.posts[2]["bind_tls"]; ok {
+		t.Error("tcp tunnel sent bind_tls")
+	}
+}
+
+func TestInitTunnelAPIError(t *testing.T) {
+	agent := &fakeAgent{failures: 5, status: http.StatusBadRequest}
+	c := testClient(t, agent)
+	tn := &Tunnel{Name: "web", Proto: HTTP, LocalAddress: "8080"}
+	err := c.InitTunnel(tn)
+	apiErr, ok := err.(*APIError)
+	if !ok || apiErr.StatusCode != http.StatusBadRequest || apiErr.ErrorCode != 102 {
+		t.Fatalf("err = %#v, want *APIError 400", err)
+	}
+	if len(agent.posts) != 1 {
+		t.Errorf("posts = %d, want 1, 400 must not be retried", len(agent.posts))
+	}
+	if tn.IsCreated {
+		t.Error("failed tunnel marked created")
+	}
+
+	if err := c.InitTunnel(&Tunnel{Name: "bad name", LocalAddress: "8080"}); err == nil {
+		t.Error("invalid tunnel reached the agent")
+	}
+	if len(agent.posts) != 1 {
+		t.Errorf("posts = %d, want 1", len(agent.posts))
+	}
+}
+
+func TestCloseTunnel(t *testing.T) {
+	agent := &fakeAgent{}
+	c := testClient(t, agent)
+	tn := &Tunnel{Name: "web", Proto: HTTP, LocalAddress: "8080"}
+	c.AddTunnel(tn)
+	if err := c.InitTunnel(tn); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.CloseTunnel(tn); err != nil {
+		t.Fatal(err)
+	}
+	got := c.FindTunnel("web")
+	if got.IsCreated || got.Healthy || got.RemoteAddress != "" {
+		t.Errorf("closed tunnel = %+v", got)
+	}
+	if len(agent.deletes) != 1 || agent.deletes[0] != "web" {
+		t.Errorf("deletes = %v", agent.deletes)
+	}
+
+	err := c.CloseTunnel(&Tunnel{Name: "gone", IsCreated: true})
+	if !IsNotFound(err) {
+		t.Errorf("close missing tunnel err = %v, want not found", err)
+	}
+}
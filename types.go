@@ -24,7 +24,11 @@ package gongrok
 */
 import (
 	"log"
+	"net"
+	"net/http"
 	"os/exec"
+	"sync"
+	"time"
 )
 
 type (
@@ -32,6 +36,14 @@ type (
 	// TYPEALIAS FOR map[string]interface{}
 	Map map[string]interface{}
 
+	// Duration -
+	// time.Duration ENCODED AS A STRING LIKE "30m" OR "1h30m"
+	Duration time.Duration
+
+	// SessionPolicy -
+	// SESSION LIMIT HANDLING, SEE SessionLimitFail/SessionLimitQueue/SessionLimitReuse
+	SessionPolicy string
+
 	// Protocol -
 	// ALIAS FOR SUPPORTED PROTOCOLS
 	Protocol int
@@ -64,28 +76,48 @@ type (
 	// info -
 	// NGROK INFO
 	info struct {
-		Count  int `json:"count"`
-		Gauge  int `json:"gauge"`
-		Rate1  int `json:"rate1"`
-		Rate5  int `json:"rate5"`
-		Rate15 int `json:"rate15"`
-		P50    int `json:"p50"`
-		P90    int `json:"p90"`
-		P95    int `json:"p95"`
-		P99    int `json:"p99"`
+		Count  int     `json:"count"`
+		Gauge  int     `json:"gauge"`
+		Rate1  float64 `json:"rate1"`
+		Rate5  float64 `json:"rate5"`
+		Rate15 float64 `json:"rate15"`
+		P50    float64 `json:"p50"`
+		P90    float64 `json:"p90"`
+		P95    float64 `json:"p95"`
+		P99    float64 `json:"p99"`
 	}
 
 	// Tunnel -
 	// INIT/CLOSE TUNNEL
 	// AUTO-CONNECT TO NGROK IF SERVER IS UP
+	// STATE FIELDS (RemoteAddress, IsCreated, Healthy, HealthErr, LastCheck) ARE GUARDED BY THE
+	// OWNING CLIENT & CHANGE IN THE BACKGROUND, READ THEM VIA Client.Snapshot OR Client.FindTunnel
 	Tunnel struct {
-		Proto         Protocol `json:"proto"`      // PROTOCOL 0, 1, 2 | HTTP, TCP, TLS
+		Proto         Protocol `json:"proto"`      // PROTOCOL "http" | "tcp" | "tls"
 		Name          string   `json:"name"`       // TUNNEL NAME IDENTIFIER
 		LocalAddress  string   `json:"localaddr"`  // HOST | HOST:PORT
 		Auth          string   `json:"auth"`       // AUTH FOR TUNNEL, IF ANY
 		Inspect       bool     `json:"inspect"`    // INSPECT TRANSACTIONAL DATA OF NGROK TUNNEL
 		RemoteAddress string   `json:"remoteaddr"` // NGROK PUBLIC ADDRESS
 		IsCreated     bool     `json:"iscreated"`  // IF TUNNEL CREATED
+
+		SubDomain    string `json:"subdomain,omitempty"`    // HTTP/TLS RESERVED SUBDOMAIN *PREMIUM*
+		Hostname     string `json:"hostname,omitempty"`     // HTTP/TLS RESERVED HOSTNAME *PREMIUM*
+		ReservedAddr string `json:"reservedaddr,omitempty"` // TCP RESERVED ADDRESS HOST:PORT *PREMIUM*
+
+		Healthy   bool      `json:"healthy"`   // RESULT OF LAST HEALTH CHECK
+		HealthErr string    `json:"healtherr"` // WHY LAST HEALTH CHECK FAILED, IF IT DID
+		LastCheck time.Time `json:"lastcheck"` // TIME OF LAST HEALTH CHECK
+
+		Preflight *Preflight `json:"preflight,omitempty"` // WAIT FOR LocalAddress BEFORE CREATING, OFF IF NIL
+		Drain     *Drain     `json:"drain,omitempty"`     // WAIT FOR OPEN CONNECTIONS BEFORE CLOSING, OFF IF NIL
+
+		MaxLifetime Duration `json:"maxlifetime,omitempty"` // CLOSE THIS LONG AFTER CREATION, OFF IF 0
+		IdleTimeout Duration `json:"idletimeout,omitempty"` // CLOSE AFTER NO NEW CONNECTIONS FOR THIS LONG, OFF IF 0
+
+		lastURL    string        // LAST PUBLIC URL, SURVIVES CLOSE TO DETECT URL CHANGES
+		expiryStop chan struct{} // CLOSE TO STOP EXPIRY WATCHER
+		desired    bool          // CREATED BY InitTunnel & NOT CLOSED SINCE, KEPT IN HEALTH CHECKS IF RE-CREATE FAILS
 	}
 	// Options -
 	// OPTIONS FOR COMMAND TO START NGROK
@@ -96,30 +128,226 @@ type (
 		CFGPath   string `json:"cfgpath"`   // NGROK CFG PATH
 		NGROKPath string `json:"binpath"`   // NGORK BIN PATH
 		LogNGROK  bool   `json:"logbin"`    // SHOULD LOG NGROK BIN OR NOT
+
+		AllOrNothing bool          `json:"allornothing"`           // CLOSE TUNNELS CREATED BY ConnectAll IF ANY TUNNEL FAILS
+		SessionLimit SessionPolicy `json:"sessionlimit,omitempty"` // WHAT Start DOES WHEN THE ACCOUNT SESSION LIMIT IS HIT
+		SessionWait  Duration      `json:"sessionwait,omitempty"`  // MAX TIME Start QUEUES W/ SessionLimitQueue, DEFAULT 5m
+		RetryPolicy  *RetryPolicy  `json:"-"`                      // RETRY POLICY FOR TUNNEL API CALLS, DEFAULT IF NIL
+		HTTPClient   *http.Client  `json:"-"`                      // CLIENT FOR AGENT API CALLS, DEFAULT USES Settings.APITimeout
 	}
 
 	// Client -
 	// NGROK CLIENT USED FOR MONITORING TUNNEL CREATION/DELETION & MORE
 	Client struct {
-		ID             string    `json:"id"`                   // IDENTIFIER FOR CLIENT
-		Options        *Options  `json:"options"`              // CMD OPTIONS
-		Tunnels        []*Tunnel `json:"tunnels"`              // ALL CLIENT TUNNELS
-		NGROKLocalAddr string    `json:"ngroklocaladdr"`       // CLIENT LOCAL SERVER FOR NGROK METRICS/API
-		LogAPI         bool      `json:"logapi"`               // SHOULD LOG API RESPONSE
-		cmds           []string  `json:"commands,omitempty"`   // CMDS USED TO RUN NGROKBIN
-		runningCMDS    *exec.Cmd `json:"runningcmd,omitempty"` // RUNNING CMDS
+		ID             string        `json:"id"`             // IDENTIFIER FOR CLIENT
+		Options        *Options      `json:"options"`        // CMD OPTIONS
+		Tunnels        []*Tunnel     `json:"tunnels"`        // ALL CLIENT TUNNELS
+		NGROKLocalAddr string        `json:"ngroklocaladdr"` // CLIENT LOCAL SERVER FOR NGROK METRICS/API
+		LogAPI         bool          `json:"logapi"`         // SHOULD LOG API RESPONSE
+		cmds           []string      // CMDS USED TO RUN NGROKBIN
+		runningCMDS    *exec.Cmd     // RUNNING CMDS
+		attached       bool          // BOUND TO AN AGENT GONGROK DID NOT START
+		ready          chan struct{} // CLOSED ONCE AGENT API IS READY
+		done           chan struct{} // CLOSED ONCE NGROK PROCESS EXITS
+		healthStop     chan struct{} // CLOSE TO STOP HEALTH CHECKER
+		mu             sync.RWMutex  // GUARDS Tunnels, TUNNEL STATE FIELDS & healthStop
+		host           *Client       // CLIENT WHOSE AGENT THIS ONE SHARES, SEE SessionLimitReuse
+		cfgDir         string        // PER CLIENT CONFIG DIR, SEE writeConfig
+		cfgMu          sync.Mutex    // GUARDS cfgDir
+	}
+
+	// HealthCheck -
+	// BACKGROUND TUNNEL HEALTH CHECK SETTINGS
+	HealthCheck struct {
+		Interval        time.Duration // TIME BETWEEN CHECKS, DEFAULT 30s
+		ProbeUpstream   bool          // ALSO DIAL EACH TUNNEL LocalAddress
+		UpstreamTimeout time.Duration // DIAL TIMEOUT FOR UPSTREAM PROBE, DEFAULT 2s
+	}
+
+	// Preflight -
+	// WAIT FOR TUNNEL UPSTREAM BEFORE CREATING IT
+	Preflight struct {
+		Timeout      Duration `json:"timeout"`                // GIVE UP AFTER, DEFAULT 30s
+		Interval     Duration `json:"interval"`               // TIME BETWEEN PROBES, DEFAULT 250ms
+		ProbeTimeout Duration `json:"probetimeout,omitempty"` // TIMEOUT FOR A SINGLE PROBE, DEFAULT 5s, CAPPED AT THE TIME LEFT
+		HTTPPath     string   `json:"httppath"`               // HTTP TUNNELS ONLY, GET PATH INSTEAD OF TCP DIAL
+	}
+
+	// Drain -
+	// GRACEFUL CLOSE SETTINGS, SEE Client.CloseTunnel
+	Drain struct {
+		Timeout     Duration            `json:"timeout"`  // DELETE ANYWAY AFTER, DEFAULT 30s
+		Interval    Duration            `json:"interval"` // TIME BETWEEN METRICS POLLS, DEFAULT 1s
+		Unadvertise func(*Tunnel) error `json:"-"`        // REMOVE TUNNEL FROM SERVICE REGISTRY BEFORE DRAINING
+	}
+
+	// Listener -
+	// net.Listener ACCEPTING CONNECTIONS FORWARDED FROM AN NGROK TUNNEL
+	// Addr REPORTS THE PUBLIC ENDPOINT, Close ALSO CLOSES THE TUNNEL
+	Listener struct {
+		net.Listener
+		Tunnel *Tunnel // TUNNEL FORWARDING TO THIS LISTENER
+		client *Client
+		once   sync.Once
+		err    error
+		closed chan struct{} // CLOSED BY Close, STOPS THE CTX WATCHER
+	}
+
+	// PublicAddr -
+	// net.Addr FOR A TUNNEL PUBLIC ENDPOINT
+	PublicAddr struct {
+		Proto Protocol // TUNNEL PROTOCOL
+		URL   string   // PUBLIC URL AS REPORTED BY NGROK
+	}
+
+	// clientState -
+	// PERSISTED CLIENT OPTIONS & DESIRED TUNNELS
+	clientState struct {
+		Version int       `json:"version"` // STATE FILE FORMAT VERSION
+		SavedAt time.Time `json:"savedat"` // TIME STATE WAS WRITTEN
+		ID      string    `json:"id"`      // CLIENT ID, KEPT ACROSS RESTORES
+		Options Options   `json:"options"` // CMD OPTIONS
+		Tunnels []*Tunnel `json:"tunnels"` // DESIRED TUNNELS
+	}
+
+	// EventType -
+	// KIND OF CLIENT OR TUNNEL LIFECYCLE CHANGE
+	EventType string
+
+	// Event -
+	// CLIENT OR TUNNEL LIFECYCLE CHANGE, SEE Subscribe
+	Event struct {
+		Type        EventType `json:"type"`                  // WHAT HAPPENED
+		ClientID    string    `json:"clientid"`              // CLIENT THE EVENT BELONGS TO
+		Tunnel      *Tunnel   `json:"tunnel,omitempty"`      // COPY OF TUNNEL FOR TUNNEL EVENTS
+		PreviousURL string    `json:"previousurl,omitempty"` // OLD PUBLIC URL FOR tunnel.url_changed & tunnel.closed
+		Reason      string    `json:"reason,omitempty"`      // WHY, FOR tunnel.expired: "lifetime" | "idle"
+		Time        time.Time `json:"time"`                  // WHEN IT HAPPENED
+	}
+
+	// Webhook -
+	// OUTBOUND NOTIFICATION OF TUNNEL EVENTS, SEE AddWebhook
+	Webhook struct {
+		URL     string       `json:"url"`              // ENDPOINT TO POST EVENTS TO
+		Secret  string       `json:"secret,omitempty"` // HMAC-SHA256 KEY FOR X-Gongrok-Signature
+		Events  []EventType  `json:"events,omitempty"` // EVENTS TO SEND, DEFAULT CREATED, CLOSED & URL CHANGED
+		Timeout Duration     `json:"timeout"`          // PER REQUEST TIMEOUT, DEFAULT 10s
+		Retry   *RetryPolicy `json:"-"`                // DELIVERY RETRIES, DEFAULT 5 ATTEMPTS
+	}
+
+	// URLExport -
+	// FILES KEPT IN SYNC W/ TUNNEL PUBLIC URLS, SEE ExportURLs
+	URLExport struct {
+		EnvFile  string `json:"envfile,omitempty"`  // .env STYLE FILE, SKIPPED IF EMPTY
+		JSONFile string `json:"jsonfile,omitempty"` // JSON STATE FILE, SKIPPED IF EMPTY
+		Prefix   string `json:"prefix,omitempty"`   // ENV VAR PREFIX, DEFAULT PUBLIC_URL
+		Default  string `json:"default,omitempty"`  // TUNNEL ALSO EXPORTED AS PLAIN <Prefix>, DEFAULT THE ONLY TUNNEL
+	}
+
+	// urlState -
+	// JSON STATE FILE WRITTEN BY ExportURLs
+	urlState struct {
+		Version int               `json:"version"` // FILE FORMAT VERSION
+		Updated time.Time         `json:"updated"` // LAST WRITE
+		Tunnels map[string]string `json:"tunnels"` // TUNNEL NAME -> PUBLIC URL
+	}
+
+	// webhookStatusError -
+	// NON-2XX RESPONSE FROM WEBHOOK ENDPOINT
+	webhookStatusError struct {
+		url    string
+		status int
+	}
+
+	// Pool -
+	// SPREADS TUNNELS ACROSS MULTIPLE NGROK AGENTS
+	// AGENTS ARE STARTED ON DEMAND & TUNNELS OF DEAD AGENTS ARE MOVED TO LIVE ONES
+	Pool struct {
+		Options   Options         // OPTIONS FOR EACH NEW AGENT
+		MaxAgents int             // MAX AGENTS RUNNING AT ONCE
+		PerAgent  int             // MAX TUNNELS PER AGENT
+		clients   []*Client       // RUNNING AGENTS
+		starting  int             // AGENTS BEING STARTED W/O p.mu HELD
+		pending   map[string]bool // TUNNEL NAMES WAITING ON A STARTING AGENT
+		closed    bool            // POOL CLOSED, NO REBALANCING
+		mu        sync.Mutex      // TAKEN BEFORE ANY AGENT'S Client.mu
+	}
+
+	// Manager -
+	// OWNS CLIENTS BY ID, SAFE FOR CONCURRENT USE
+	Manager struct {
+		MaxAgents int                // MAX AGENTS RUNNING AT ONCE, 0 IS UNLIMITED
+		clients   map[string]*Client // MANAGED CLIENTS BY ID
+		starting  int                // AGENTS BEING STARTED BY NewClient
+		closed    bool               // MANAGER CLOSED, NO NEW CLIENTS
+		mu        sync.RWMutex
+	}
+
+	// ValidationError -
+	// EVERY PROBLEM FOUND BY Tunnel.Validate
+	ValidationError struct {
+		Tunnel   string   // TUNNEL NAME
+		Problems []string // ONE ENTRY PER INVALID FIELD
+	}
+
+	// MultiError -
+	// RESULT OF A MULTI-TUNNEL OPERATION
+	// MAPS EACH TUNNEL NAME TO ITS ERROR, NIL ON SUCCESS
+	MultiError struct {
+		Results        map[string]error // TUNNEL NAME -> RESULT
+		RolledBack     []string         // TUNNELS CLOSED AFTER A FAILED ALL-OR-NOTHING CONNECT
+		RollbackFailed map[string]error // TUNNEL NAME -> CLOSE ERROR, STILL EXPOSED AFTER A FAILED ROLLBACK
+	}
+
+	// ngrokTunnelList -
+	// AGENT RESPONSE FOR GET /api/tunnels
+	ngrokTunnelList struct {
+		Tunnels []ngrokTunnelRecord `json:"tunnels"`
+		URI     string              `json:"uri"`
+	}
+
+	// ngrokRequestList -
+	// AGENT RESPONSE FOR GET /api/requests/http
+	ngrokRequestList struct {
+		Requests []Map  `json:"requests"`
+		URI      string `json:"uri"`
+	}
+
+	// APIError -
+	// ERROR RESPONSE FROM THE NGROK AGENT API
+	APIError struct {
+		ErrorCode  int    `json:"error_code"`  // NGROK ERROR CODE
+		StatusCode int    `json:"status_code"` // HTTP STATUS CODE
+		Msg        string `json:"msg"`         // SUMMARY MESSAGE
+		Details    Map    `json:"details"`     // EXTRA CONTEXT, USUALLY {"err": "..."}
+	}
+
+	// RetryPolicy -
+	// HOW TUNNEL API CALLS ARE RETRIED
+	// ZERO VALUES FALL BACK TO DefaultRetryPolicy
+	RetryPolicy struct {
+		MaxAttempts    int              // TOTAL ATTEMPTS INCLUDING THE FIRST
+		InitialBackoff time.Duration    // WAIT BEFORE THE FIRST RETRY
+		MaxBackoff     time.Duration    // UPPER BOUND FOR A SINGLE WAIT
+		Multiplier     float64          // BACKOFF GROWTH PER ATTEMPT
+		Jitter         float64          // RANDOMIZE EACH WAIT BY +/- THIS FRACTION (0 - 1)
+		MaxElapsed     time.Duration    // GIVE UP ONCE THIS MUCH TIME HAS PASSED, 0 FOR NO LIMIT
+		Retryable      func(error) bool // IF ERROR SHOULD BE RETRIED, DEFAULT IsRetryable
 	}
 
 	// settings -
 	// GONGROK SETTINGS
 	settings struct {
-		Path          string `json:"path"`          // PATH TO NGROK BINARY FILE (https://ngrok.com/download)
-		DefaultPath   string `json:"default_path"`  // PATH TO NGROK BINARY FILE (https://ngrok.com/download)
-		LogDir        string `json:"logdir"`        // DIRECTORY WHERE USER WANTS LOGS TO POPULATE
-		LogAPI        bool   `json:"logapi"`        // SHOULD LOG API OR NOT
-		ShouldLog     bool   `json:"shouldlog"`     // SHOULD LOG ANYTHING
-		MaxRetries    uint8  `json:"maxretries"`    // HOW MANY RETRIES OF TUNNEL CREATION/DELETION
-		TunnelAPIAddr string `json:"tunnelAPIaddr"` // ADDRESS OF NGROK TUNNEL API
+		Path           string        `json:"path"`           // PATH TO NGROK BINARY FILE (https://ngrok.com/download)
+		DefaultPath    string        `json:"default_path"`   // PATH TO NGROK BINARY FILE (https://ngrok.com/download)
+		LogDir         string        `json:"logdir"`         // DIRECTORY WHERE USER WANTS LOGS TO POPULATE
+		LogAPI         bool          `json:"logapi"`         // SHOULD LOG API OR NOT
+		ShouldLog      bool          `json:"shouldlog"`      // SHOULD LOG ANYTHING
+		HandleSignals  bool          `json:"handlesignals"`  // FORWARD SIGNALS TO NGROK & EXIT, DISABLE TO HANDLE THEM YOURSELF
+		MaxRetries     uint8         `json:"maxretries"`     // HOW MANY RETRIES OF TUNNEL CREATION/DELETION
+		TunnelAPIAddr  string        `json:"tunnelAPIaddr"`  // ADDRESS OF NGROK TUNNEL API
+		RequestAPIAddr string        `json:"requestAPIaddr"` // ADDRESS OF NGROK CAPTURED REQUESTS API
+		APITimeout     time.Duration `json:"apitimeout"`     // TIMEOUT FOR EACH AGENT API REQUEST W/ DEFAULT HTTP CLIENT
 	}
 )
 
@@ -127,7 +355,9 @@ const (
 	ngReady          = `starting web service.*addr=(\d+\.\d+\.\d+\.\d+:\d+)`   // IS NGROK READY
 	ngInUse          = `address already in use`                                // IS PORT IN USE
 	ngSessionLimited = `is limited to (\d+) simultaneous ngrok client session` // CHECK NGROK LIMIT
+	ngSession        = `client session established`                            // TUNNEL SESSION UP, AGENT READY
 	webURI           = `\d+\.\d+\.\d+\.\d+:\d+`                                // FIND NGROK CLIENT SERVER
+	startAttempts    = 3                                                       // Start TRIES BEFORE GIVING UP ON ErrAddrInUse
 )
 
 // SUPPORTED PROTOCOLS
@@ -146,13 +376,16 @@ var (
 	// Settings -
 	// NGROK DEFAULT SETTINGS
 	Settings = settings{
-		Path:          "./ngrok_bin/ngrok",
-		DefaultPath:   "./ngrok_bin/ngrok",
-		LogDir:        "./logs",
-		LogAPI:        false,
-		ShouldLog:     false,
-		MaxRetries:    50,
-		TunnelAPIAddr: "http://%s/api/tunnels",
+		Path:           "./ngrok_bin/ngrok",
+		DefaultPath:    "./ngrok_bin/ngrok",
+		LogDir:         "./logs",
+		LogAPI:         false,
+		ShouldLog:      false,
+		HandleSignals:  true,
+		MaxRetries:     50,
+		TunnelAPIAddr:  "http://%s/api/tunnels",
+		RequestAPIAddr: "http://%s/api/requests/http",
+		APITimeout:     10 * time.Second,
 	}
 	// Logger -
 	// LOGGER
@@ -160,11 +393,44 @@ var (
 )
 
 func (t *Tunnel) getJSON() Map {
-	return Map{
+	m := Map{
 		"addr":    t.LocalAddress,
 		"proto":   protocols[t.Proto],
 		"name":    t.Name,
 		"inspect": t.Inspect,
 		"auth":    t.Auth,
 	}
+	if t.SubDomain != "" {
+		m["subdomain"] = t.SubDomain
+	}
+	if t.Hostname != "" {
+		m["hostname"] = t.Hostname
+	}
+	if t.ReservedAddr != "" {
+		m["remote_addr"] = t.ReservedAddr
+	}
+	return m
+}
+
+// toTunnel -
+// CONVERT AGENT TUNNEL RECORD TO Tunnel
+func (r *ngrokTunnelRecord) toTunnel() *Tunnel {
+	proto, _ := ParseProtocol(r.Proto)
+	return &Tunnel{
+		Proto:         proto,
+		Name:          r.Name,
+		LocalAddress:  r.Config.Addr,
+		Inspect:       r.Config.Inspect,
+		RemoteAddress: r.PublicURL,
+		IsCreated:     true,
+	}
+}
+
+// snapshot -
+// COPY OF TUNNEL W/O ITS EXPIRY WATCHER
+// CALLER MUST HOLD THE OWNING CLIENT'S mu
+func (t *Tunnel) snapshot() *Tunnel {
+	cp := *t
+	cp.expiryStop = nil
+	return &cp
 }
@@ -0,0 +1,191 @@
+package gongrok
+
+/*
+	Copyright 2021 revzim.
+
+	Permission is hereby granted, free of charge, to any person obtaining a
+	copy of this software and associated documentation files (the "Software"),
+	to deal in the Software without restriction, including without limitation
+	the rights to use, copy, modify, merge, publish, distribute, sublicense,
+	and/or sell copies of the Software, and to permit persons to whom the Software
+	is furnished to do so, subject to the following conditions:
+
+	The above copyright notice and this permission notice shall be included
+	in all copies or substantial portions of the Software.
+
+	THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND,
+	EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES
+	OF MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT.
+	IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM,
+	DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE,
+	ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER
+	DEALINGS IN THE SOFTWARE.
+
+*/
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+var (
+	tunnelNameRe = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9_.-]{0,63}$`)                  // TUNNEL NAME CHARSET
+	subDomainRe  = regexp.MustCompile(`^[a-z0-9]([a-z0-9-]{0,61}[a-z0-9])?$`)               // DNS LABEL
+	hostnameRe   = regexp.MustCompile(`^([a-z0-9]([a-z0-9-]{0,61}[a-z0-9])?\.)+[a-z]{2,}$`) // FQDN
+	localSchemes = map[string]bool{"http": true, "https": true, "file": true, "tcp": true, "tls": true}
+)
+
+// Validate -
+// CHECK TUNNEL FIELDS BEFORE HITTING THE AGENT
+// RETURNS *ValidationError LISTING EVERY PROBLEM FOUND
+func (t *Tunnel) Validate() error {
+	verr := &ValidationError{Tunnel: t.Name}
+
+	if !tunnelNameRe.MatchString(t.Name) {
+		verr.add("name %q must be 1-64 letters, digits, '_', '-' or '.' and start w/ a letter or digit", t.Name)
+	}
+
+	if _, ok := protocols[t.Proto]; !ok {
+		verr.add("unsupported protocol %d", int(t.Proto))
+	}
+
+	if err := validateLocalAddress(t.LocalAddress); err != nil {
+		verr.add("localaddr: %s", err)
+	}
+
+	if t.Auth != "" {
+		if t.Proto != HTTP {
+			verr.add("auth is only supported for http tunnels")
+		}
+		parts := strings.SplitN(t.Auth, ":", 2)
+		if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+			verr.add("auth must be in user:pass format")
+		}
+	}
+
+	if t.SubDomain != "" {
+		if t.Proto == TCP {
+			verr.add("subdomain is not supported for tcp tunnels")
+		}
+		if !subDomainRe.MatchString(t.SubDomain) {
+			verr.add("subdomain %q must be 1-63 lowercase letters, digits or '-' and not start or end w/ '-'", t.SubDomain)
+		}
+	}
+
+	if t.Hostname != "" {
+		if t.Proto == TCP {
+			verr.add("hostname is not supported for tcp tunnels")
+		}
+		if !hostnameRe.MatchString(t.Hostname) {
+			verr.add("hostname %q is not a valid domain name", t.Hostname)
+		}
+		if t.SubDomain != "" {
+			verr.add("subdomain & hostname cannot both be set")
+		}
+	}
+
+	if t.ReservedAddr != "" {
+		if t.Proto != TCP {
+			verr.add("reservedaddr is only supported for tcp tunnels")
+		}
+		if _, port, err := net.SplitHostPort(t.ReservedAddr); err != nil || !validPort(port) {
+			verr.add("reservedaddr %q must be host:port", t.ReservedAddr)
+		}
+	}
+
+	if t.MaxLifetime < 0 {
+		verr.add("maxlifetime must not be negative")
+	}
+	if t.IdleTimeout < 0 {
+		verr.add("idletimeout must not be negative")
+	}
+
+	if len(verr.Problems) > 0 {
+		return verr
+	}
+	return nil
+}
+
+// Error -
+// LISTS EVERY VALIDATION PROBLEM
+func (e *ValidationError) Error() string {
+	return fmt.Sprintf("invalid tunnel %q: %s", e.Tunnel, strings.Join(e.Problems, "; "))
+}
+
+// add -
+// APPEND PROBLEM
+func (e *ValidationError) add(format string, args ...interface{}) {
+	e.Problems = append(e.Problems, fmt.Sprintf(format, args...))
+}
+
+// validateTunnel -
+// VALIDATE TUNNEL & CHECK NAME IS UNIQUE AMONG CLIENT TUNNELS
+// CALLER MUST HOLD c.mu
+func (c *Client) validateTunnel(t *Tunnel) error {
+	err := t.Validate()
+	verr, ok := err.(*ValidationError)
+	if !ok {
+		verr = &ValidationError{Tunnel: t.Name}
+	}
+	for _, existing := range c.Tunnels {
+		if existing != t && existing.Name == t.Name {
+			verr.add("name %q already used by another tunnel on this client", t.Name)
+			break
+		}
+	}
+	if len(verr.Problems) > 0 {
+		return verr
+	}
+	return nil
+}
+
+// validateLocalAddress -
+// ACCEPTS PORT | HOST:PORT | URL
+func validateLocalAddress(addr string) error {
+	if addr == "" {
+		return fmt.Errorf("missing")
+	}
+	if strings.Contains(addr, "://") {
+		u, err := url.Parse(addr)
+		if err != nil {
+			return err
+		}
+		if !localSchemes[u.Scheme] {
+			return fmt.Errorf("unsupported scheme %q", u.Scheme)
+		}
+		if u.Scheme != "file" && u.Hostname() == "" {
+			return fmt.Errorf("%q has no host", addr)
+		}
+		if u.Port() != "" && !validPort(u.Port()) {
+			return fmt.Errorf("invalid port %q", u.Port())
+		}
+		return nil
+	}
+	if !strings.Contains(addr, ":") {
+		if validPort(addr) {
+			return nil
+		}
+		return fmt.Errorf("%q must be port, host:port or url", addr)
+	}
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return err
+	}
+	if host == "" {
+		return fmt.Errorf("%q has no host", addr)
+	}
+	if !validPort(port) {
+		return fmt.Errorf("invalid port %q", port)
+	}
+	return nil
+}
+
+// validPort -
+// 1 - 65535
+func validPort(port string) bool {
+	n, err := strconv.Atoi(port)
+	return err == nil && n > 0 && n < 65536
+}
@@ -0,0 +1,94 @@
+package gongrok
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestValidate(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		tunnel   Tunnel
+		problems []string // SUBSTRINGS, ONE PER EXPECTED PROBLEM
+	}{
+		{"http port", Tunnel{Name: "web", Proto: HTTP, LocalAddress: "8080"}, nil},
+		{"http host:port", Tunnel{Name: "web", Proto: HTTP, LocalAddress: "localhost:8080", Auth: "user:pass", SubDomain: "my-app"}, nil},
+		{"http url", Tunnel{Name: "web.v2", Proto: HTTP, LocalAddress: "https://localhost", Hostname: "app.example.com"}, nil},
+		{"file url", Tunnel{Name: "files", Proto: HTTP, LocalAddress: "file:///var/www"}, nil},
+		{"tcp reserved", Tunnel{Name: "db", Proto: TCP, LocalAddress: "5432", ReservedAddr: "1.tcp.ngrok.io:20000"}, nil},
+		{"lifetimes", Tunnel{Name: "tmp", Proto: TLS, LocalAddress: "443", MaxLifetime: Duration(time.Hour), IdleTimeout: Duration(time.Minute)}, nil},
+
+		{"empty", Tunnel{}, []string{"name", "localaddr: missing"}},
+		{"bad name", Tunnel{Name: "-web", LocalAddress: "8080"}, []string{"name \"-web\""}},
+		{"long name", Tunnel{Name: strings.Repeat("a", 65), LocalAddress: "8080"}, []string{"name"}},
+		{"bad proto", Tunnel{Name: "web", Proto: Protocol(7), LocalAddress: "8080"}, []string{"unsupported protocol 7"}},
+		{"bad port", Tunnel{Name: "web", LocalAddress: "70000"}, []string{"localaddr"}},
+		{"no host", Tunnel{Name: "web", LocalAddress: ":8080"}, []string{"has no host"}},
+		{"bad scheme", Tunnel{Name: "web", LocalAddress: "ftp://localhost"}, []string{"unsupported scheme"}},
+		{"tcp auth", Tunnel{Name: "db", Proto: TCP, LocalAddress: "5432", Auth: "user"}, []string{"only supported for http", "user:pass"}},
+		{"tcp subdomain", Tunnel{Name: "db", Proto: TCP, LocalAddress: "5432", SubDomain: "My_App"}, []string{"not supported for tcp", "subdomain \"My_App\""}},
+		{"subdomain & hostname", Tunnel{Name: "web", LocalAddress: "8080", SubDomain: "app", Hostname: "localhost"}, []string{"not a valid domain", "cannot both be set"}},
+		{"http reserved", Tunnel{Name: "web", LocalAddress: "8080", ReservedAddr: "nope"}, []string{"only supported for tcp", "must be host:port"}},
+		{"negative", Tunnel{Name: "web", LocalAddress: "8080", MaxLifetime: -1, IdleTimeout: -1}, []string{"maxlifetime", "idletimeout"}},
+	} {
+		err := tc.tunnel.Validate()
+		if len(tc.problems) == 0 {
+			if err != nil {
+				t.Errorf("%s: Validate = %s, want nil", tc.name, err)
+			}
+			continue
+		}
+		var verr *ValidationError
+		if !errors.As(err, &verr) {
+			t.Errorf("%s: Validate = %v, want *ValidationError", tc.name, err)
+			continue
+		}
+		if len(verr.Problems) != len(tc.problems) {
+			t.Errorf("%s: problems = %q, want %d", tc.name, verr.Problems, len(tc.problems))
+			continue
+		}
+		for i, want := range tc.problems {
+			if !strings.Contains(verr.Problems[i], want) {
+				t.Errorf("%s: problem %d = %q, want %q", tc.name, i, verr.Problems[i], want)
+			}
+		}
+	}
+}
+
+func TestValidateUniqueName(t *testing.T) {
+	c := &Client{}
+	if err := c.AddTunnel(&Tunnel{Name: "web", LocalAddress: "8080"}); err != nil {
+		t.Fatal(err)
+	}
+	err := c.AddTunnel(&Tunnel{Name: "web", LocalAddress: "9090"})
+	var verr *ValidationError
+	if !errors.As(err, &verr) || !strings.Contains(err.Error(), "already used") {
+		t.Fatalf("duplicate name err = %v", err)
+	}
+	if len(c.Tunnels) != 1 {
+		t.Errorf("tunnels = %d, want 1", len(c.Tunnels))
+	}
+}
+
+func TestMultiErrorString(t *testing.T) {
+	merr := &MultiError{Results: map[string]error{
+		"web": nil,
+		"db":  errors.New("boom"),
+		"api": &APIError{StatusCode: 502},
+	}}
+	if got, want := merr.Failed(), []string{"api", "db"}; strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Errorf("Failed = %v, want %v", got, want)
+	}
+	if got, want := merr.Error(), "2 of 3 tunnels failed: api: error api: 502; db: boom"; got != want {
+		t.Errorf("Error = %q, want %q", got, want)
+	}
+
+	merr.RolledBack = []string{"web"}
+	merr.RollbackFailed = map[string]error{"cache": errors.New("timeout")}
+	want := "2 of 3 tunnels failed: api: error api: 502; db: boom (rolled back: web) (rollback failed: cache: timeout)"
+	if got := merr.Error(); got != want {
+		t.Errorf("Error = %q, want %q", got, want)
+	}
+}
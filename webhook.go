@@ -0,0 +1,169 @@
+package gongrok
+
+/*
+	Copyright 2021 revzim.
+
+	Permission is hereby granted, free of charge, to any person obtaining a
+	copy of this software and associated documentation files (the "Software"),
+	to deal in the Software without restriction, including without limitation
+	the rights to use, copy, modify, merge, publish, distribute, sublicense,
+	and/or sell copies of the Software, and to permit persons to whom the Software
+	is furnished to do so, subject to the following conditions:
+
+	The above copyright notice and this permission notice shall be included
+	in all copies or substantial portions of the Software.
+
+	THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND,
+	EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES
+	OF MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT.
+	IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM,
+	DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE,
+	ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER
+	DEALINGS IN THE SOFTWARE.
+
+*/
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const (
+	webhookQueueSize = 128 // EVENTS BUFFERED PER WEBHOOK BEFORE DROPPING
+)
+
+var (
+	// defaultWebhookEvents -
+	// SENT WHEN Webhook.Events IS EMPTY
+	defaultWebhookEvents = []EventType{EventTunnelCreated, EventTunnelClosed, EventTunnelURLChanged}
+)
+
+// Error -
+// WEBHOOK URL & STATUS
+func (e *webhookStatusError) Error() string {
+	return fmt.Sprintf("webhook %s: status %d", e.url, e.status)
+}
+
+// AddWebhook -
+// POST EVERY MATCHING EVENT TO HOOK.URL AS JSON
+// DELIVERY IS ASYNC, IN ORDER & RETRIED; RETURNS FUNC TO REMOVE THE HOOK
+//
+// HEADERS:
+//
+//	X-Gongrok-Event: EVENT TYPE
+//	X-Gongrok-Timestamp: UNIX SECONDS
+//	X-Gongrok-Signature: sha256=HEX(HMAC-SHA256(SECRET, TIMESTAMP + "." + BODY)) IF SECRET SET
+func AddWebhook(hook Webhook) func() {
+	if hook.Timeout <= 0 {
+		hook.Timeout = Duration(10 * time.Second)
+	}
+	if len(hook.Events) < 1 {
+		hook.Events = defaultWebhookEvents
+	}
+	policy := hook.Retry
+	if policy == nil {
+		policy = &RetryPolicy{MaxAttempts: 5, InitialBackoff: time.Second, MaxBackoff: 30 * time.Second}
+	}
+	policy = policy.withDefaults()
+	if hook.Retry == nil || hook.Retry.Retryable == nil {
+		policy.Retryable = webhookRetryable
+	}
+
+	wanted := make(map[EventType]bool)
+	for _, typ := range hook.Events {
+		wanted[typ] = true
+	}
+
+	queue := make(chan Event, webhookQueueSize)
+	client := &http.Client{Timeout: time.Duration(hook.Timeout)}
+	go func() {
+		for e := range queue {
+			if err := policy.do(context.Background(), func() error { return hook.send(client, e) }); err != nil {
+				if Settings.ShouldLog {
+					Logger.Printf("webhook %s %s err: %s\n", hook.URL, e.Type, err)
+				}
+			}
+		}
+	}()
+
+	unsubscribe := Subscribe(func(e Event) {
+		if !wanted[e.Type] {
+			return
+		}
+		select {
+		case queue <- e:
+		default:
+			if Settings.ShouldLog {
+				Logger.Printf("webhook %s queue full, dropped %s\n", hook.URL, e.Type)
+			}
+		}
+	})
+	return func() {
+		unsubscribe()
+		close(queue)
+	}
+}
+
+// send -
+// POST ONE EVENT
+func (hook *Webhook) send(client *http.Client, e Event) error {
+	if e.Tunnel != nil && e.Tunnel.Auth != "" {
+		// NEVER SEND TUNNEL CREDENTIALS TO THIRD PARTIES
+		cp := *e.Tunnel
+		cp.Auth = ""
+		e.Tunnel = &cp
+	}
+	body, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest(http.MethodPost, hook.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "gongrok-webhook")
+	req.Header.Set("X-Gongrok-Event", string(e.Type))
+	req.Header.Set("X-Gongrok-Timestamp", timestamp)
+	if hook.Secret != "" {
+		req.Header.Set("X-Gongrok-Signature", "sha256="+SignWebhook(hook.Secret, timestamp, body))
+	}
+
+	res, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	res.Body.Close()
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		return &webhookStatusError{url: hook.URL, status: res.StatusCode}
+	}
+	return nil
+}
+
+// SignWebhook -
+// HEX HMAC-SHA256 OF TIMESTAMP + "." + BODY, FOR VERIFYING X-Gongrok-Signature
+func SignWebhook(secret, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// webhookRetryable -
+// RETRY NETWORK ERRORS, 408, 429 & 5XX
+func webhookRetryable(err error) bool {
+	serr, ok := err.(*webhookStatusError)
+	if !ok {
+		return err != nil
+	}
+	return serr.status == http.StatusRequestTimeout || serr.status == http.StatusTooManyRequests || serr.status >= 500
+}
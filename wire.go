@@ -0,0 +1,156 @@
+package gongrok
+
+/*
+	Copyright 2021 revzim.
+
+	Permission is hereby granted, free of charge, to any person obtaining a
+	copy of this software and associated documentation files (the "Software"),
+	to deal in the Software without restriction, including without limitation
+	the rights to use, copy, modify, merge, publish, distribute, sublicense,
+	and/or sell copies of the Software, and to permit persons to whom the Software
+	is furnished to do so, subject to the following conditions:
+
+	The above copyright notice and this permission notice shall be included
+	in all copies or substantial portions of the Software.
+
+	THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND,
+	EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES
+	OF MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT.
+	IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM,
+	DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE,
+	ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER
+	DEALINGS IN THE SOFTWARE.
+
+*/
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// JSON WIRE FORMAT
+//
+// Client, Options & Tunnel USE THEIR json TAGS, Protocol IS ENCODED AS
+// "http" | "tcp" | "tls". Client OBJECTS CARRY "version": WireVersion.
+// DURATIONS ARE ENCODED AS STRINGS LIKE "30s", SEE Duration.
+// DECODING STILL ACCEPTS LEGACY INTEGER PROTOCOLS (0, 1, 2) & INTEGER NANOSECOND DURATIONS.
+const (
+	// WireVersion -
+	// CURRENT VERSION OF THE Client JSON REPRESENTATION
+	// BUMPED WHEN A FIELD IS RENAMED, REMOVED OR CHANGES TYPE
+	WireVersion = 2
+)
+
+// ParseProtocol -
+// PARSE "http" | "https" | "tcp" | "tls" (CASE INSENSITIVE) OR "0" | "1" | "2"
+func ParseProtocol(s string) (Protocol, error) {
+	name := strings.ToLower(strings.TrimSpace(s))
+	if name == "https" {
+		return HTTP, nil
+	}
+	for p, pname := range protocols {
+		if pname == name {
+			return p, nil
+		}
+	}
+	if n, err := strconv.Atoi(name); err == nil {
+		if _, ok := protocols[Protocol(n)]; ok {
+			return Protocol(n), nil
+		}
+	}
+	return HTTP, fmt.Errorf("unsupported protocol: %q", s)
+}
+
+// String -
+// PROTOCOL NAME
+func (p Protocol) String() string {
+	if name, ok := protocols[p]; ok {
+		return name
+	}
+	return fmt.Sprintf("Protocol(%d)", int(p))
+}
+
+// MarshalJSON -
+// ENCODE PROTOCOL AS ITS NAME
+func (p Protocol) MarshalJSON() ([]byte, error) {
+	name, ok := protocols[p]
+	if !ok {
+		return nil, fmt.Errorf("unsupported protocol: %d", int(p))
+	}
+	return json.Marshal(name)
+}
+
+// UnmarshalJSON -
+// DECODE PROTOCOL NAME OR LEGACY INTEGER
+func (p *Protocol) UnmarshalJSON(data []byte) error {
+	var name string
+	if err := json.Unmarshal(data, &name); err != nil {
+		var n int
+		if err := json.Unmarshal(data, &n); err != nil {
+			return fmt.Errorf("protocol must be a string or integer: %s", data)
+		}
+		name = strconv.Itoa(n)
+	}
+	parsed, err := ParseProtocol(name)
+	if err != nil {
+		return err
+	}
+	*p = parsed
+	return nil
+}
+
+// MarshalJSON -
+// ENCODE DURATION AS A STRING, E.G. "30m0s"
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+// UnmarshalJSON -
+// DECODE DURATION STRING OR INTEGER NANOSECONDS
+func (d *Duration) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		var n int64
+		if err := json.Unmarshal(data, &n); err != nil {
+			return fmt.Errorf("duration must be a string like \"30m\" or integer nanoseconds: %s", data)
+		}
+		*d = Duration(n)
+		return nil
+	}
+	parsed, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	*d = Duration(parsed)
+	return nil
+}
+
+// MarshalJSON -
+// ENCODE CLIENT W/ WIRE VERSION & A SNAPSHOT OF ITS TUNNELS
+func (c *Client) MarshalJSON() ([]byte, error) {
+	type client Client
+	return json.Marshal(struct {
+		Version int `json:"version"`
+		*client
+		Tunnels []*Tunnel `json:"tunnels"`
+	}{WireVersion, (*client)(c), c.Snapshot()})
+}
+
+// UnmarshalJSON -
+// DECODE CLIENT, REJECTS NEWER WIRE VERSIONS
+func (c *Client) UnmarshalJSON(data []byte) error {
+	type client Client
+	wire := struct {
+		Version int `json:"version"`
+		*client
+	}{client: (*client)(c)}
+	if err := json.Unmarshal(data, &wire); err != nil {
+		return err
+	}
+	if wire.Version > WireVersion {
+		return fmt.Errorf("client wire version %d is newer than supported %d", wire.Version, WireVersion)
+	}
+	return nil
+}
@@ -0,0 +1,183 @@
+package gongrok
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestProtocolJSON(t *testing.T) {
+	for _, tc := range []struct {
+		proto Protocol
+		name  string
+	}{
+		{HTTP, "http"},
+		{TCP, "tcp"},
+		{TLS, "tls"},
+	} {
+		data, err := json.Marshal(tc.proto)
+		if err != nil {
+			t.Fatalf("marshal %s: %s", tc.name, err)
+		}
+		if string(data) != `"`+tc.name+`"` {
+			t.Errorf("marshal %s = %s", tc.name, data)
+		}
+		var p Protocol
+		if err := json.Unmarshal(data, &p); err != nil {
+			t.Fatalf("unmarshal %s: %s", data, err)
+		}
+		if p != tc.proto {
+			t.Errorf("unmarshal %s = %d, want %d", data, p, tc.proto)
+		}
+	}
+}
+
+func TestProtocolLegacyInts(t *testing.T) {
+	for in, want := range map[string]Protocol{"0": HTTP, "1": TCP, "2": TLS} {
+		var p Protocol
+		if err := json.Unmarshal([]byte(in), &p); err != nil {
+			t.Fatalf("unmarshal %s: %s", in, err)
+		}
+		if p != want {
+			t.Errorf("unmarshal %s = %s, want %s", in, p, want)
+		}
+	}
+}
+
+func TestProtocolRejectsUnknown(t *testing.T) {
+	for _, in := range []string{`"udp"`, `""`, `7`, `-1`, `true`, `{}`} {
+		var p Protocol
+		if err := json.Unmarshal([]byte(in), &p); err == nil {
+			t.Errorf("unmarshal %s = %s, want error", in, p)
+		}
+	}
+	if _, err := json.Marshal(Protocol(9)); err == nil {
+		t.Error("marshal Protocol(9), want error")
+	}
+}
+
+func TestClientRoundTrip(t *testing.T) {
+	c := &Client{
+		ID:             "c1",
+		Options:        &Options{Region: "eu", NGROKPath: "./ngrok", AllOrNothing: true},
+		NGROKLocalAddr: "127.0.0.1:4040",
+		LogAPI:         true,
+		Tunnels: []*Tunnel{
+			{Proto: HTTP, Name: "web", LocalAddress: "8080", RemoteAddress: "https://a.ngrok.io", IsCreated: true},
+			{Proto: TCP, Name: "db", LocalAddress: "5432", ReservedAddr: "1.tcp.ngrok.io:20000"},
+		},
+	}
+	data, err := json.Marshal(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	wire := map[string]interface{}{}
+	if err := json.Unmarshal(data, &wire); err != nil {
+		t.Fatal(err)
+	}
+	if v, ok := wire["version"].(float64); !ok || int(v) != WireVersion {
+		t.Errorf("version = %v, want %d", wire["version"], WireVersion)
+	}
+
+	got := &Client{}
+	if err := json.Unmarshal(data, got); err != nil {
+		t.Fatal(err)
+	}
+	if got.ID != c.ID || got.NGROKLocalAddr != c.NGROKLocalAddr || got.LogAPI != c.LogAPI {
+		t.Errorf("client = %+v, want %+v", got, c)
+	}
+	if got.Options == nil || *got.Options != *c.Options {
+		t.Errorf("options = %+v, want %+v", got.Options, c.Options)
+	}
+	if len(got.Tunnels) != len(c.Tunnels) {
+		t.Fatalf("%d tunnels, want %d", len(got.Tunnels), len(c.Tunnels))
+	}
+	for i := range c.Tunnels {
+		if *got.Tunnels[i] != *c.Tunnels[i] {
+			t.Errorf("tunnel %d = %+v, want %+v", i, got.Tunnels[i], c.Tunnels[i])
+		}
+	}
+}
+
+func TestClientRejectsNewerVersion(t *testing.T) {
+	data := []byte(`{"version": 3, "id": "c1"}`)
+	err := json.Unmarshal(data, &Client{})
+	if err == nil || !strings.Contains(err.Error(), "newer") {
+		t.Errorf("unmarshal version 3 err = %v, want newer version error", err)
+	}
+}
+
+func TestClientMockData(t *testing.T) {
+	data, err := ioutil.ReadFile(filepath.Join("example", "webapp", "public", "mockdata", "client_tunnel.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	mock := struct {
+		Data struct {
+			Client *Client `json:"client"`
+			Tunnel *Tunnel `json:"tunnel"`
+		} `json:"data"`
+	}{}
+	if err := json.Unmarshal(data, &mock); err != nil {
+		t.Fatal(err)
+	}
+	c := mock.Data.Client
+	if c == nil || c.ID != "c0cebc0c-8299-4110-83e3-c1ec305638dc" || len(c.Tunnels) != 1 {
+		t.Fatalf("client = %+v", c)
+	}
+	if c.Tunnels[0].Proto != HTTP || c.Tunnels[0].Name != "dnd" || mock.Data.Tunnel.Proto != HTTP {
+		t.Errorf("tunnel = %+v", c.Tunnels[0])
+	}
+}
+
+func TestTunnelDurations(t *testing.T) {
+	tn := &Tunnel{}
+	if err := json.Unmarshal([]byte(`{"maxlifetime": "30m", "idletimeout": 5000000000}`), tn); err != nil {
+		t.Fatal(err)
+	}
+	if time.Duration(tn.MaxLifetime) != 30*time.Minute || time.Duration(tn.IdleTimeout) != 5*time.Second {
+		t.Errorf("maxlifetime = %s, idletimeout = %s", time.Duration(tn.MaxLifetime), time.Duration(tn.IdleTimeout))
+	}
+	data, err := json.Marshal(tn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(data), `"maxlifetime":"30m0s"`) || !strings.Contains(string(data), `"idletimeout":"5s"`) {
+		t.Errorf("marshal = %s", data)
+	}
+	if err := json.Unmarshal([]byte(`{"maxlifetime": "soon"}`), tn); err == nil {
+		t.Error("unmarshal maxlifetime \"soon\", want error")
+	}
+}
+
+func TestWireDurations(t *testing.T) {
+	tn := &Tunnel{}
+	if err := json.Unmarshal([]byte(`{"preflight": {"timeout": "30s", "interval": 250000000}, "drain": {"timeout": "1m", "interval": "2s"}}`), tn); err != nil {
+		t.Fatal(err)
+	}
+	if time.Duration(tn.Preflight.Timeout) != 30*time.Second || time.Duration(tn.Preflight.Interval) != 250*time.Millisecond {
+		t.Errorf("preflight = %+v", tn.Preflight)
+	}
+	if time.Duration(tn.Drain.Timeout) != time.Minute || time.Duration(tn.Drain.Interval) != 2*time.Second {
+		t.Errorf("drain = %+v", tn.Drain)
+	}
+
+	opt := Options{}
+	if err := json.Unmarshal([]byte(`{"sessionwait": "90s"}`), &opt); err != nil {
+		t.Fatal(err)
+	}
+	if time.Duration(opt.SessionWait) != 90*time.Second {
+		t.Errorf("sessionwait = %s", time.Duration(opt.SessionWait))
+	}
+
+	hook := Webhook{}
+	if err := json.Unmarshal([]byte(`{"url": "https://example.com", "timeout": "5s"}`), &hook); err != nil {
+		t.Fatal(err)
+	}
+	if time.Duration(hook.Timeout) != 5*time.Second {
+		t.Errorf("webhook timeout = %s", time.Duration(hook.Timeout))
+	}
+}